@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"koko/token"
+	"strconv"
 	"strings"
 )
 
@@ -10,21 +11,25 @@ var EMPTY_SPAN = Span{empty: true}
 
 type Span struct {
 	empty     bool
+	File      string
 	BeginLine int
 	BeginPos  int
 }
 
 func spanFromToken(t token.Token) Span {
-	return Span{BeginLine: t.Context.LineNumber, BeginPos: t.Context.PositionInLine}
+	return Span{File: t.Context.File, BeginLine: t.Context.LineNumber, BeginPos: t.Context.PositionInLine}
 }
 
+// Empty reports whether the span has no position, e.g. for builtin values
+func (s Span) Empty() bool { return s.empty }
+
 func (s Span) merge(other Span) Span {
-	out := Span{BeginLine: s.BeginLine, BeginPos: s.BeginPos}
+	out := Span{File: s.File, BeginLine: s.BeginLine, BeginPos: s.BeginPos}
 	if s.empty {
-		out = Span{BeginLine: other.BeginLine, BeginPos: other.BeginPos, empty: other.empty}
+		out = Span{File: other.File, BeginLine: other.BeginLine, BeginPos: other.BeginPos, empty: other.empty}
 		return out
 	} else if other.empty {
-		out = Span{BeginLine: s.BeginLine, BeginPos: s.BeginPos, empty: s.empty}
+		out = Span{File: s.File, BeginLine: s.BeginLine, BeginPos: s.BeginPos, empty: s.empty}
 		return out
 	}
 	if other.BeginLine < s.BeginLine || (other.BeginLine == s.BeginLine && other.BeginPos < s.BeginPos) {
@@ -150,6 +155,74 @@ func (ls *LetStatement) Span() Span {
 	return out
 }
 
+// CellStatement binds a name like a let statement, but its value is
+// recomputed whenever a binding it depends on is bound again
+type CellStatement struct {
+	Token token.Token // the token.CELL token
+	Name  *Identifier
+	Value Expression
+}
+
+func (cs *CellStatement) statementNode()       {}
+func (cs *CellStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *CellStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Name.String())
+	out.WriteString(" = ")
+
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+func (cs *CellStatement) Span() Span {
+	out := spanFromToken(cs.Token)
+	if cs.Value != nil {
+		out = out.merge(cs.Value.Span())
+	}
+	return out
+}
+
+// ConstStatement binds a name like a let statement, but the binding can't
+// be assigned to or bound again in the same scope
+type ConstStatement struct {
+	Token token.Token // the token.CONST token
+	Name  *Identifier
+	Value Expression
+}
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ConstStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Name.String())
+	out.WriteString(" = ")
+
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+func (cs *ConstStatement) Span() Span {
+	out := spanFromToken(cs.Token)
+	if cs.Value != nil {
+		out = out.merge(cs.Value.Span())
+	}
+	return out
+}
+
 type ReturnStatement struct {
 	Token       token.Token // the 'return' token
 	ReturnValue Expression
@@ -179,6 +252,79 @@ func (rs *ReturnStatement) Span() Span {
 	return out
 }
 
+type WhileStatement struct {
+	Token     token.Token // the 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while ")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" { ")
+	out.WriteString(ws.Body.String())
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+func (ws *WhileStatement) Span() Span {
+	out := spanFromToken(ws.Token)
+	out = out.merge(ws.Condition.Span())
+	return out.merge(ws.Body.Span())
+}
+
+type ForStatement struct {
+	Token    token.Token // the 'for' token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for ")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(" { ")
+	out.WriteString(fs.Body.String())
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+func (fs *ForStatement) Span() Span {
+	out := spanFromToken(fs.Token)
+	out = out.merge(fs.Iterable.Span())
+	return out.merge(fs.Body.Span())
+}
+
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return "break;" }
+func (bs *BreakStatement) Span() Span           { return spanFromToken(bs.Token) }
+
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+func (cs *ContinueStatement) Span() Span           { return spanFromToken(cs.Token) }
+
 type ExpressionStatement struct {
 	Token      token.Token // the first token of the expression
 	Expression Expression
@@ -301,12 +447,53 @@ type StringLiteral struct {
 func (str *StringLiteral) expressionNode()      {}
 func (str *StringLiteral) TokenLiteral() string { return str.Token.Literal }
 func (str *StringLiteral) String() string {
-	return "\"" + str.Token.Literal + "\""
+	return `"` + quoteText(str.Token.Literal) + `"`
 }
 func (str *StringLiteral) Span() Span {
 	return spanFromToken(str.Token)
 }
 
+// InterpolatedString is a string with expressions in it, e.g.
+// "count is ${count}". Its parts alternate between the text around the
+// expressions, as string literals, and the expressions, so that it starts
+// and ends with text.
+type InterpolatedString struct {
+	Token token.Token // the STRING_START token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(`"`)
+	for i, part := range is.Parts {
+		if i%2 == 0 {
+			out.WriteString(quoteText(part.(*StringLiteral).Value))
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+	out.WriteString(`"`)
+
+	return out.String()
+}
+func (is *InterpolatedString) Span() Span {
+	out := spanFromToken(is.Token)
+	for _, part := range is.Parts {
+		out = out.merge(part.Span())
+	}
+	return out
+}
+
+// quoteText escapes text to be written between double quotes, including the
+// `${` which would start an interpolation
+func quoteText(text string) string {
+	quoted := strconv.Quote(text)
+	return strings.ReplaceAll(quoted[1:len(quoted)-1], "${", `\${`)
+}
+
 type FloatLiteral struct {
 	Token token.Token
 	Value float64
@@ -371,6 +558,38 @@ func (ie *InfixExpression) Span() Span {
 	return out
 }
 
+// AssignExpression updates the nearest existing binding of a name, with `=`
+// or a compound operator like `+=`, and evaluates to the new value. The
+// parser only allows identifiers, and index expressions into them, as
+// targets.
+type AssignExpression struct {
+	Token    token.Token // the assignment operator token
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+func (ae *AssignExpression) Span() Span {
+	out := spanFromToken(ae.Token)
+	out = out.merge(ae.Target.Span())
+	out = out.merge(ae.Value.Span())
+	return out
+}
+
 type IfExpression struct {
 	Token       token.Token // The 'if' token
 	Condition   Expression
@@ -563,6 +782,45 @@ func (ie *IndexExpression) Span() Span {
 	return out
 }
 
+// SliceExpression takes part of a string or array, e.g. s[1:3]. Either
+// bound can be left out, to slice from the start or up to the end.
+type SliceExpression struct {
+	Token token.Token // The [ token
+	Left  Expression
+	Start Expression
+	End   Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
+func (se *SliceExpression) Span() Span {
+	out := spanFromToken(se.Token)
+	out = out.merge(se.Left.Span())
+	if se.Start != nil {
+		out = out.merge(se.Start.Span())
+	}
+	if se.End != nil {
+		out = out.merge(se.End.Span())
+	}
+	return out
+}
+
 type HashLiteral struct {
 	Token token.Token // { token
 	Pairs map[Expression]Expression
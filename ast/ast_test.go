@@ -26,3 +26,30 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestWalk(t *testing.T) {
+	x := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"}
+	y := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "y"}, Value: "y"}
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Expression: &InfixExpression{Left: x, Operator: "+", Right: &FunctionLiteral{
+					Parameters: []*Identifier{y},
+					Body:       &BlockStatement{},
+				}},
+			},
+		},
+	}
+
+	seen := []string{}
+	Walk(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			seen = append(seen, ident.Value)
+		}
+		_, isFunction := node.(*FunctionLiteral)
+		return !isFunction
+	})
+	if len(seen) != 1 || seen[0] != "x" {
+		t.Errorf("Walk visited wrong identifiers. got=%v", seen)
+	}
+}
@@ -0,0 +1,120 @@
+package ast
+
+// Walk traverses the tree rooted at node in depth-first order. It calls fn
+// for every node, and only descends into the children of a node when fn
+// returns true for it.
+func Walk(node Node, fn func(Node) bool) {
+	if isNilNode(node) || !fn(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			Walk(s, fn)
+		}
+	case *LetStatement:
+		Walk(node.Name, fn)
+		Walk(node.Value, fn)
+	case *CellStatement:
+		Walk(node.Name, fn)
+		Walk(node.Value, fn)
+	case *ConstStatement:
+		Walk(node.Name, fn)
+		Walk(node.Value, fn)
+	case *ReturnStatement:
+		Walk(node.ReturnValue, fn)
+	case *WhileStatement:
+		Walk(node.Condition, fn)
+		Walk(node.Body, fn)
+	case *ForStatement:
+		Walk(node.Variable, fn)
+		Walk(node.Iterable, fn)
+		Walk(node.Body, fn)
+	case *ExpressionStatement:
+		Walk(node.Expression, fn)
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			Walk(s, fn)
+		}
+	case *PrefixExpression:
+		Walk(node.Right, fn)
+	case *InfixExpression:
+		Walk(node.Left, fn)
+		Walk(node.Right, fn)
+	case *AssignExpression:
+		Walk(node.Target, fn)
+		Walk(node.Value, fn)
+	case *IfExpression:
+		Walk(node.Condition, fn)
+		Walk(node.Consequence, fn)
+		Walk(node.Alternative, fn)
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			Walk(p, fn)
+		}
+		Walk(node.Body, fn)
+	case *PureFunctionLiteral:
+		for _, p := range node.Parameters {
+			Walk(p, fn)
+		}
+		Walk(node.Body, fn)
+	case *CallExpression:
+		Walk(node.Function, fn)
+		for _, a := range node.Arguments {
+			Walk(a, fn)
+		}
+	case *InterpolatedString:
+		for _, part := range node.Parts {
+			Walk(part, fn)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			Walk(el, fn)
+		}
+	case *IndexExpression:
+		Walk(node.Left, fn)
+		Walk(node.Index, fn)
+	case *SliceExpression:
+		Walk(node.Left, fn)
+		Walk(node.Start, fn)
+		Walk(node.End, fn)
+	case *HashLiteral:
+		for key, value := range node.Pairs {
+			Walk(key, fn)
+			Walk(value, fn)
+		}
+	}
+}
+
+// isNilNode catches both nil interfaces and typed nil pointers, which the
+// parser leaves behind for optional parts like a missing else block
+func isNilNode(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *BlockStatement:
+		return node == nil
+	case *Identifier:
+		return node == nil
+	case *LetStatement:
+		return node == nil
+	case *CellStatement:
+		return node == nil
+	case *ConstStatement:
+		return node == nil
+	case *ReturnStatement:
+		return node == nil
+	case *WhileStatement:
+		return node == nil
+	case *ForStatement:
+		return node == nil
+	case *BreakStatement:
+		return node == nil
+	case *ContinueStatement:
+		return node == nil
+	case *ExpressionStatement:
+		return node == nil
+	}
+	return false
+}
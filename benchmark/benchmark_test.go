@@ -21,21 +21,34 @@ func testBuild(input string) (*ast.Program, *object.Environment) {
 	return program, env
 }
 
-func BenchmarkFib(b *testing.B) {
-	program, env := testBuild(`let fib = fn(x) { if (x == 1) { 1 } else { if (x ==0) { 1} else { fib(x - 1) + fib(x - 2) }}};fib(8)`)
-	for i := 0; i < b.N; i++ {
-		evaluator.Eval(program, env)
+// benchmarkProgram runs a program with and without dependency tracing
+func benchmarkProgram(b *testing.B, input string) {
+	modes := []struct {
+		name string
+		opts evaluator.EvalOptions
+	}{
+		{"Traced", evaluator.EvalOptions{Trace: true}},
+		{"Untraced", evaluator.EvalOptions{Trace: false}},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			program, env := testBuild(input)
+			for i := 0; i < b.N; i++ {
+				evaluator.EvalWithOptions(program, env, mode.opts)
+			}
+		})
 	}
 }
 
+func BenchmarkFib(b *testing.B) {
+	benchmarkProgram(b, `let fib = fn(x) { if (x == 1) { 1 } else { if (x ==0) { 1} else { fib(x - 1) + fib(x - 2) }}};fib(8)`)
+}
+
 func BenchmarkCollatz(b *testing.B) {
-	program, env := testBuild(`
+	benchmarkProgram(b, `
 	let collatz = fn(n) { if (n==1) { 0 } else { if (n%2 == 0) { collatz(int(n/2)) + 1 } else { collatz(3*n + 1) + 1 }}};
 	let compute_sum_of_first_n_collatz = fn(n) { if (n== 1) { 0 } else { collatz(n) + compute_sum_of_first_n_collatz(n - 1) }};
 	compute_sum_of_first_n_collatz(10)`)
-	for i := 0; i < b.N; i++ {
-		evaluator.Eval(program, env)
-	}
 }
 
 func BenchmarkMergeSort(b *testing.B) {
@@ -53,7 +66,7 @@ func BenchmarkMergeSort(b *testing.B) {
 		}
 	}
 	strInput += "]"
-	program, env := testBuild(fmt.Sprintf(`
+	benchmarkProgram(b, fmt.Sprintf(`
 	let get_n_elements = fn(arr, offset, number_of_elements) { if (number_of_elements == 0) { [] } else { [arr[offset]] + get_n_elements(arr, offset + 1, number_of_elements - 1) } }
 
 	let first = fn(a) { a[0] }
@@ -82,13 +95,10 @@ func BenchmarkMergeSort(b *testing.B) {
 	let merge_sort = fn(arr) { if (len(arr) < 2) { return arr } else { let half = int(len(arr)/2); let res_lower = get_n_elements(arr, 0, half); let res_upper = get_n_elements(arr, half, len(arr) - half); merge_elements(merge_sort(res_lower), merge_sort(res_upper)) } }
 	merge_sort(%s)
 	`, strInput))
-	for i := 0; i < b.N; i++ {
-		evaluator.Eval(program, env)
-	}
 }
 
 func BenchmarkRockHopper(b *testing.B) {
-	program, env := testBuild(`
+	benchmarkProgram(b, `
 	let RAND_CONST = 10
 	let random_array = fn(len) { if (len == 0) { [] } else { [rando(RAND_CONST)] + random_array(len - 1) } }
 	let ra = random_array(1000)
@@ -97,7 +107,4 @@ func BenchmarkRockHopper(b *testing.B) {
 	let repeat_rock_hopper_with_modifications = fn(repeats, arr) { if (repeats != 0) { let mod_ind = rando(len(arr)); rock_hopper(arr, 0); repeat_rock_hopper_with_modifications(repeats - 1, get_n_elements(arr, 0, mod_ind) + [rando(RAND_CONST)] + get_n_elements(arr, mod_ind, len(arr) - mod_ind))}}
 	repeat_rock_hopper_with_modifications(10, ra)
 	`)
-	for i := 0; i < b.N; i++ {
-		evaluator.Eval(program, env)
-	}
 }
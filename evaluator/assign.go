@@ -0,0 +1,132 @@
+package evaluator
+
+import (
+	"koko/ast"
+	"koko/object"
+	"strings"
+)
+
+// evalAssignExpression binds a name again in the scope which binds it, so
+// closures can update the state they captured. Compound assignments like
+// `+=` read the target before the value is evaluated.
+//
+// Assigning to an element, e.g. `grid[y][x] = v`, doesn't change the array
+// or hash the name is bound to, which other bindings may share. It binds the
+// name to a copy with the element replaced instead, copying every container
+// on the way down to it.
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	rt := env.Runtime()
+	root, indexNodes := assignmentTarget(node.Target)
+	containers := []object.Object{}
+	indexes := []object.Object{}
+	var current object.Object
+	if len(indexNodes) > 0 || node.Operator != "=" {
+		current = Eval(root, env)
+		if isError(current) {
+			return current
+		}
+	}
+	for i, indexNode := range indexNodes {
+		index := Eval(indexNode, env)
+		if isError(index) {
+			return index
+		}
+		containers = append(containers, current)
+		indexes = append(indexes, index)
+		// the element assigned to is only read by compound assignments
+		if i == len(indexNodes)-1 && node.Operator == "=" {
+			break
+		}
+		current = evalIndexExpression(rt, current, index)
+		if isError(current) {
+			return current
+		}
+	}
+
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	if node.Operator != "=" {
+		val = evalInfixExpression(rt, strings.TrimSuffix(node.Operator, "="), current, val)
+		if isError(val) {
+			return val
+		}
+	}
+	val = withControlDependencies(rt, val)
+
+	updated := val
+	for i := len(containers) - 1; i >= 0; i-- {
+		updated = withElement(rt, containers[i], indexes[i], updated)
+		if isError(updated) {
+			return updated
+		}
+	}
+	noteLoopBinding(rt, root.Value, updated)
+	if res := env.Assign(root.Value, updated); isError(res) {
+		return res
+	}
+	return val
+}
+
+// assignmentTarget splits the target of an assignment into the name it
+// updates and the indexes leading to the element which is assigned, outermost
+// first
+func assignmentTarget(target ast.Expression) (*ast.Identifier, []ast.Expression) {
+	indexes := []ast.Expression{}
+	for {
+		index, ok := target.(*ast.IndexExpression)
+		if !ok {
+			break
+		}
+		indexes = append([]ast.Expression{index.Index}, indexes...)
+		target = index.Left
+	}
+	return target.(*ast.Identifier), indexes
+}
+
+// withElement returns a copy of an array or hash with the element at index
+// replaced by val. Hashes get a new key when index isn't one of theirs, but
+// arrays don't grow.
+func withElement(rt *object.Runtime, container object.Object, index object.Object, val object.Object) object.Object {
+	switch container := container.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(container.Elements)) {
+			return newError("index %d out of range for array of length %d", i.Value, len(container.Elements))
+		}
+		elements := make([]object.Object, len(container.Elements))
+		for j, el := range container.Elements {
+			elements[j] = rt.Copy(el)
+		}
+		elements[i.Value] = rt.Copy(val)
+		// the position of the new element depends on the index
+		rt.AddDependency(elements[i.Value], index)
+
+		res := rt.CreateArray(elements)
+		rt.AddDependency(&res.Length, &container.Length)
+		rt.AddDependency(&res.Offset, &container.Offset)
+		return res
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		pairs := make(map[object.HashKey]object.HashPair, len(container.Pairs)+1)
+		for k, pair := range container.Pairs {
+			pairs[k] = object.HashPair{Key: pair.Key, Value: rt.Copy(pair.Value)}
+		}
+		pairs[key.HashKey()] = object.HashPair{Key: index, Value: rt.Copy(val)}
+
+		res := rt.CreateHash(pairs)
+		// whether a key was added depends on the hash's keys, which its
+		// length stands for
+		rt.AddDependency(&res.Length, &container.Length)
+		rt.AddDependency(&res.Offset, &container.Offset)
+		return res
+	}
+	return newError("index assignment not supported: %s", container.Type())
+}
@@ -8,46 +8,28 @@ import (
 	"math/rand"
 	"sort"
 	"strconv"
+	"unicode/utf8"
 )
 
 var builtins map[string]*object.Builtin
 
-// NOTE (Peter) this function is techincal debt
-func getObjRelatedDependenciesInTrace(obj object.Object, trace map[object.Object]bool, prefix string, out map[string]bool) {
-	if _, ok := trace[obj]; ok {
-		out[prefix] = true
-	}
-	if arrObj, ok := obj.(*object.Array); ok {
-		if _, ok := trace[&arrObj.Length]; ok {
-			out[prefix+"#"] = true
-		}
-		for i, subObj := range arrObj.Elements {
-			getObjRelatedDependenciesInTrace(subObj, trace, prefix+"|"+fmt.Sprint(i), out)
-		}
-	}
-	if hashObj, ok := obj.(*object.Hash); ok {
-		if _, ok := trace[&hashObj.Length]; ok {
-			out[prefix+"#"] = true
-		}
-		for _, pair := range hashObj.Pairs {
-			getObjRelatedDependenciesInTrace(pair.Value, trace, prefix+"|@"+fmt.Sprint(pair.Key.Inspect()), out)
-		}
-	}
-}
-
 // Builtins is in an init so that its creation is deferred and we can define
 // the builtin function builtins without an initialization loop
 func init() {
 	builtins = map[string]*object.Builtin{
 		"builtins": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: true,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(0, args); err != object.NIL {
 					return err
 				}
-				builtinStringKeys := make([]string, 0, len(builtins))
+				builtinStringKeys := make([]string, 0, len(builtins)+len(scopedBuiltins))
 				for builtinStringKey := range builtins {
 					builtinStringKeys = append(builtinStringKeys, builtinStringKey)
 				}
+				for builtinStringKey := range scopedBuiltins {
+					builtinStringKeys = append(builtinStringKeys, builtinStringKey)
+				}
 				sort.Strings(builtinStringKeys)
 				builtinKeys := make([]object.Object, 0, len(builtins))
 				for _, builtinFunction := range builtinStringKeys {
@@ -56,48 +38,121 @@ func init() {
 						&object.String{Value: builtinFunction},
 					)
 				}
-				return object.CreateArray(builtinKeys)
+				return rt.CreateArray(builtinKeys)
 			},
 		},
 		"print": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: false,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if len(args) != 1 {
 					return newError("wrong number of arguments. got=%d, need 1",
 						len(args))
 				}
 
 				res := args[0]
-				fmt.Println(res.Inspect())
+				if err := refuseLabels(rt, "print", res, nil); err != nil {
+					return err
+				}
+				fmt.Fprintln(rt.Out, res.Inspect())
 				return res
 			},
 		},
+		"taint": &object.Builtin{
+			Pure: false,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if err := requireTracing(rt, "taint"); err != nil {
+					return err
+				}
+				if err := validateNumberOfArgs(2, args); err != object.NIL {
+					return err
+				}
+				if args[1].Type() != object.STRING_OBJ {
+					return newError("second argument to `taint` must be STRING, got %s", args[1].Type())
+				}
+				return object.AttachLabel(args[0], rt.NewLabel(args[1].(*object.String).Value))
+			},
+		},
+		"labels": &object.Builtin{
+			Pure: false,
+			// the names of the labels don't depend on the value, so that
+			// they can be printed even when the value can't
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if err := requireTracing(rt, "labels"); err != nil {
+					return err
+				}
+				if err := validateNumberOfArgs(1, args); err != object.NIL {
+					return err
+				}
+				elements := []object.Object{}
+				for _, name := range rt.Labels(args[0]) {
+					elements = append(elements, &object.String{Value: name})
+				}
+				return rt.CreateArray(elements)
+			},
+		},
+		"sink": &object.Builtin{
+			Pure: false,
+			// sink passes a value through, unless it carries one of the
+			// given labels, or any label when none are given
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if err := requireTracing(rt, "sink"); err != nil {
+					return err
+				}
+				if len(args) < 1 {
+					return newError("wrong number of arguments. got=%d, need at least=%d",
+						len(args), 1)
+				}
+				forbidden := make(map[string]bool)
+				for _, arg := range args[1:] {
+					if arg.Type() != object.STRING_OBJ {
+						return newError("labels given to `sink` must be STRING, got %s", arg.Type())
+					}
+					forbidden[arg.(*object.String).Value] = true
+				}
+				if err := refuseLabels(rt, "sink", args[0], forbidden); err != nil {
+					return err
+				}
+				return args[0]
+			},
+		},
 		"deps": &object.Builtin{
-			// NOTE this function is legacy to support tests from the old version
-			// TODO (Peter) update this to a better version later
-			Fn: func(args ...object.Object) object.Object {
+			Pure: false,
+			// deps calls a function with the remaining args and traces which
+			// parts of the args its result depended on
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if err := requireTracing(rt, "deps"); err != nil {
+					return err
+				}
 				if len(args) < 1 {
 					return newError("wrong number of arguments. got=%d, need at least=%d",
 						len(args), 1)
 				}
 
 				fn := args[0]
-				fnRes := applyFunction(fn, args[1:])
+				fnRes := applyFunction(rt, fn, args[1:])
+				if isError(fnRes) {
+					return fnRes
+				}
 
 				traceDeps := object.GetAllDependencies(fnRes)
-				argDeps := make(map[string]bool)
-				for i, arg := range args[1:] {
-					getObjRelatedDependenciesInTrace(arg, traceDeps, fmt.Sprint(i), argDeps)
+				argDeps := []string{}
+				for _, path := range object.CollectDependencyPaths(args[1:], traceDeps) {
+					argDeps = append(argDeps, path.String())
 				}
 
-				res := object.DebugTraceMetadata{DebugMetadata: argDeps}
-				res.AddDependency(fnRes)
-				return &res
+				res := object.NewTrace(fnRes, argDeps)
+				rt.AddDependency(res, fnRes)
+				return res
 			},
 		},
-		"dep_diagraph": {
+		"dep_diagraph": &object.Builtin{
+			Pure: false,
 			// NOTE this function is legacy to support tests from the old version
 			// TODO (Peter) update this to a better version later
-			Fn: func(args ...object.Object) object.Object {
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if err := requireTracing(rt, "dep_diagraph"); err != nil {
+					return err
+				}
 				if len(args) != 1 {
 					return newError("wrong number of arguments. got=%d, need 1",
 						len(args))
@@ -106,13 +161,72 @@ func init() {
 				arg := args[0]
 
 				res := object.String{Value: object.GetAllDependenciesToDotLang(arg)}
-				res.AddDependency(arg)
+				rt.AddDependency(&res, arg)
 
 				return &res
 			},
 		},
+		"dep_graph_json": &object.Builtin{
+			Pure: false,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if err := requireTracing(rt, "dep_graph_json"); err != nil {
+					return err
+				}
+				if err := validateNumberOfArgs(1, args); err != object.NIL {
+					return err
+				}
+
+				out, err := object.GetDependencyGraphJSON(args[0])
+				if err != nil {
+					return newError("can't export dependency graph: %s", err)
+				}
+				res := &object.String{Value: out}
+				rt.AddDependency(res, args[0])
+				return res
+			},
+		},
+		"dep_html": &object.Builtin{
+			Pure: false,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if err := requireTracing(rt, "dep_html"); err != nil {
+					return err
+				}
+				if err := validateNumberOfArgs(2, args); err != object.NIL {
+					return err
+				}
+				if args[1].Type() != object.STRING_OBJ {
+					return newError("second argument to `dep_html` must be STRING, got %s", args[1].Type())
+				}
+
+				page, err := DependencyGraphHTML(rt, args[0])
+				if err != nil {
+					return newError("can't export dependency graph: %s", err)
+				}
+				fileLocation := args[1].(*object.String).Value
+				if err := ioutil.WriteFile(fileLocation, []byte(page), 0644); err != nil {
+					return newError("File writing error %v", fileLocation)
+				}
+				return rt.Copy(object.NIL)
+			},
+		},
+		"why": &object.Builtin{
+			Pure: false,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if err := requireTracing(rt, "why"); err != nil {
+					return err
+				}
+				if err := validateNumberOfArgs(1, args); err != object.NIL {
+					return err
+				}
+
+				res := &object.String{Value: object.Explain(args[0])}
+				rt.AddDependency(res, args[0])
+				return res
+			},
+		},
 		"len": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: true,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
@@ -122,43 +236,55 @@ func init() {
 				case *object.Array:
 					value = int64(len(args[0].(*object.Array).Elements))
 					res := object.Integer{Value: value}
-					res.AddDependency(&args[0].(*object.Array).Length)
+					rt.AddDependency(&res, &args[0].(*object.Array).Length)
 					return &res
 				case *object.Hash:
 					value = int64(len(args[0].(*object.Hash).Pairs))
 					res := object.Integer{Value: value}
-					res.AddDependency(&args[0].(*object.Hash).Length)
+					rt.AddDependency(&res, &args[0].(*object.Hash).Length)
 					return &res
+				case *object.Trace:
+					res := &object.Integer{Value: int64(len(args[0].(*object.Trace).Deps))}
+					rt.AddDependency(res, args[0])
+					return res
 				default:
-					value = int64(len(args[0].String().Value))
+					// strings are as long as the characters in them, not the bytes
+					value = int64(utf8.RuneCountInString(args[0].String().Value))
 					res := object.Integer{Value: value}
-					res.AddDependency(args[0])
+					rt.AddDependency(&res, args[0])
 					return &res
 				}
 			},
 		},
 		"type": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: true,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
 
-				return &object.String{Value: string(args[0].Type())}
+				res := &object.String{Value: string(args[0].Type())}
+				rt.AddDependency(res, args[0])
+				return res
 			},
 		},
 		"string": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: true,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
 
 				// JEM: WHy can't this be:
 				// return args[0].String()
-				return &object.String{Value: args[0].Inspect()}
+				res := &object.String{Value: args[0].Inspect()}
+				rt.AddDependency(res, args[0])
+				return res
 			},
 		},
 		"array": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: true,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
@@ -169,11 +295,13 @@ func init() {
 				case *object.String:
 					for _, val := range arg.Value {
 						e := &object.String{Value: string(val)}
-						e.AddDependency(arg)
+						rt.AddDependency(e, arg)
 						elements = append(elements, e)
 					}
 				case *object.Array:
 					return arg
+				case *object.Trace:
+					return arg.DepsArray()
 				default:
 					elements = append(elements, arg)
 				}
@@ -183,22 +311,26 @@ func init() {
 				res := object.Array{Elements: elements}
 				res.Offset.ASTCreator = &ast.StringLiteral{Value: "OFFSET"}
 				res.Length.ASTCreator = &ast.StringLiteral{Value: "LENGTHA"}
-				res.AddDependency(args[0])
-				res.AddLengthDependency(args[0])
+				rt.AddDependency(&res, args[0])
+				rt.AddDependency(&res.Length, args[0])
 				return &res
 			},
 		},
 		"bool": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: true,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
 
-				return &object.Boolean{Value: object.Bool(args[0])}
+				res := &object.Boolean{Value: object.Bool(args[0])}
+				rt.AddDependency(res, args[0])
+				return res
 			},
 		},
 		"int": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: true,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
@@ -208,27 +340,27 @@ func init() {
 					return arg
 				case *object.Float:
 					res := &object.Integer{Value: int64(arg.Value)}
-					res.AddDependency(arg)
+					rt.AddDependency(res, arg)
 					return res
 				case *object.Boolean:
 					if arg.Equal(object.TRUE) {
 						res := &object.Integer{Value: 1}
-						res.AddDependency(arg)
+						rt.AddDependency(res, arg)
 						return res
 					} else {
 						res := &object.Integer{Value: 0}
-						res.AddDependency(arg)
+						rt.AddDependency(res, arg)
 						return res
 					}
 				case *object.String:
 					i, err := strconv.ParseInt(arg.String().Value, 10, 64)
 					if err != nil {
-						res := object.NIL.Copy()
-						res.AddDependency(arg)
+						res := rt.Copy(object.NIL)
+						rt.AddDependency(res, arg)
 						return res
 					} else {
 						res := &object.Integer{Value: i}
-						res.AddDependency(arg)
+						rt.AddDependency(res, arg)
 						return res
 					}
 				default:
@@ -237,7 +369,8 @@ func init() {
 			},
 		},
 		"float": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: true,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
@@ -245,28 +378,30 @@ func init() {
 				switch arg := args[0].(type) {
 				case *object.Integer:
 					res := &object.Float{Value: float64(arg.Value)}
-					res.AddDependency(arg)
+					rt.AddDependency(res, arg)
 					return res
 				case *object.Float:
 					return arg
 				case *object.Boolean:
 					if arg == object.TRUE {
 						res := &object.Float{Value: 1}
-						res.AddDependency(arg)
+						rt.AddDependency(res, arg)
 						return res
 					} else {
 						res := &object.Float{Value: 0}
-						res.AddDependency(arg)
+						rt.AddDependency(res, arg)
 						return res
 					}
 				case *object.String:
 					f, err := strconv.ParseFloat(arg.String().Value, 64)
 					if err != nil {
-						res := object.NIL.Copy()
-						res.AddDependency(arg)
+						res := rt.Copy(object.NIL)
+						rt.AddDependency(res, arg)
 						return res
 					} else {
-						return &object.Float{Value: f}
+						res := &object.Float{Value: f}
+						rt.AddDependency(res, arg)
+						return res
 					}
 				default:
 					return newError("can't cast %s to a float", arg.Type())
@@ -274,7 +409,8 @@ func init() {
 			},
 		},
 		"keys": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: true,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
@@ -286,14 +422,20 @@ func init() {
 				hash := args[0].(*object.Hash)
 				elements := make([]object.Object, 0, len(hash.Pairs))
 				for _, hashPair := range hash.Pairs {
-					elements = append(elements, hashPair.Key)
+					// which keys there are depends on the hash's keys
+					key := rt.Copy(hashPair.Key)
+					rt.AddDependency(key, &hash.Length)
+					elements = append(elements, key)
 				}
-				return object.CreateArray(elements)
+				res := rt.CreateArray(elements)
+				rt.AddDependency(&res.Length, &hash.Length)
+				return res
 			},
 		},
 		"values": &object.Builtin{
+			Pure: true,
 			// JEM: Possible refactor to pull these out
-			Fn: func(args ...object.Object) object.Object {
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
@@ -305,13 +447,19 @@ func init() {
 				hash := args[0].(*object.Hash)
 				elements := make([]object.Object, 0, len(hash.Pairs))
 				for _, hashPair := range hash.Pairs {
-					elements = append(elements, hashPair.Value)
+					// which values there are depends on the keys they're under
+					value := rt.Copy(hashPair.Value)
+					rt.AddDependency(value, &hash.Length)
+					elements = append(elements, value)
 				}
-				return object.CreateArray(elements)
+				res := rt.CreateArray(elements)
+				rt.AddDependency(&res.Length, &hash.Length)
+				return res
 			},
 		},
 		"read": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: false,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
@@ -327,12 +475,13 @@ func init() {
 					return newError("File reading error %v", fileLocation)
 				}
 				res := &object.String{Value: string(data)}
-				res.AddDependency(args[0])
+				rt.AddDependency(res, args[0])
 				return res
 			},
 		},
 		"rando": &object.Builtin{
-			Fn: func(args ...object.Object) object.Object {
+			Pure: false,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 				if err := validateNumberOfArgs(1, args); err != object.NIL {
 					return err
 				}
@@ -346,11 +495,115 @@ func init() {
 					return newError("argument to `rando` must be at least 1, got %v", arg.Value)
 				}
 				res := &object.Integer{Value: int64(rand.Intn(int(arg.Value)))}
-				res.AddDependency(arg)
+				rt.AddDependency(res, arg)
+				return res
+			},
+		},
+		"cache_stats": &object.Builtin{
+			Pure: false,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if err := validateNumberOfArgs(1, args); err != object.NIL {
+					return err
+				}
+
+				fn, ok := args[0].(*object.PureFunction)
+				if !ok {
+					return newError("argument to `cache_stats` must be a pure function, got %s", args[0].Type())
+				}
+
+				stats := fn.Cache.Stats()
+				limit, policy := fn.Cache.Limit()
+				fields := map[string]object.Object{
+					"hits":      &object.Integer{Value: stats.Hits},
+					"misses":    &object.Integer{Value: stats.Misses},
+					"evictions": &object.Integer{Value: stats.Evictions},
+					"size":      &object.Integer{Value: int64(fn.Cache.Len())},
+					"limit":     &object.Integer{Value: int64(limit)},
+					"policy":    &object.String{Value: policy.String()},
+				}
+				pairs := make(map[object.HashKey]object.HashPair)
+				for name, val := range fields {
+					key := &object.String{Value: name}
+					rt.AddDependency(val, fn)
+					pairs[key.HashKey()] = object.HashPair{Key: key, Value: val}
+				}
+				res := rt.CreateHash(pairs)
+				rt.AddDependency(res, fn)
 				return res
 			},
 		},
+		"cache_clear": &object.Builtin{
+			Pure: false,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if err := validateNumberOfArgs(1, args); err != object.NIL {
+					return err
+				}
+
+				fn, ok := args[0].(*object.PureFunction)
+				if !ok {
+					return newError("argument to `cache_clear` must be a pure function, got %s", args[0].Type())
+				}
+
+				fn.Cache.Clear()
+				return rt.Copy(object.NIL)
+			},
+		},
+		"cache_limit": &object.Builtin{
+			Pure: false,
+			Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				if len(args) != 2 && len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+				}
+
+				fn, ok := args[0].(*object.PureFunction)
+				if !ok {
+					return newError("first argument to `cache_limit` must be a pure function, got %s", args[0].Type())
+				}
+				limit, ok := args[1].(*object.Integer)
+				if !ok || limit.Value < 0 {
+					return newError("second argument to `cache_limit` must be a non-negative INTEGER, got %s", args[1].Inspect())
+				}
+				policy := object.LRU
+				if len(args) == 3 {
+					name, ok := args[2].(*object.String)
+					if !ok {
+						return newError("third argument to `cache_limit` must be STRING, got %s", args[2].Type())
+					}
+					var err error
+					if policy, err = object.ParseEvictionPolicy(name.Value); err != nil {
+						return newError("%s", err)
+					}
+				}
+
+				fn.Cache.SetLimit(int(limit.Value), policy)
+				return fn
+			},
+		},
+	}
+}
+
+// refuseLabels returns an error when val carries a label in forbidden, or any
+// label when forbidden is empty. Without tracing labels can't be seen, so
+// nothing is refused.
+func refuseLabels(rt *object.Runtime, name string, val object.Object, forbidden map[string]bool) object.Object {
+	if !rt.Tracing() {
+		return nil
+	}
+	for _, label := range rt.Labels(val) {
+		if len(forbidden) == 0 || forbidden[label] {
+			return newError("`%s` refused a value labeled %q", name, label)
+		}
+	}
+	return nil
+}
+
+// requireTracing returns an error for builtins which need dependencies when
+// tracing is off, since their results would silently be empty
+func requireTracing(rt *object.Runtime, name string) object.Object {
+	if !rt.Tracing() {
+		return newError("`%s` needs dependency tracing, which is turned off", name)
 	}
+	return nil
 }
 
 func validateNumberOfArgs(length int, args []object.Object) object.Object {
@@ -0,0 +1,169 @@
+package evaluator
+
+import (
+	"koko/ast"
+	"koko/object"
+	"sort"
+)
+
+// A cell is a binding whose value is recomputed whenever a binding it
+// depends on is bound again, e.g. by a let statement, like a spreadsheet
+// cell. The bindings it depends on are the names its expression refers to
+// directly, which also catches functions which are re-defined, and the
+// bindings its value was computed from according to the dependency graph,
+// which catches names read inside the functions it calls.
+type cell struct {
+	node     *ast.CellStatement
+	env      *object.Environment
+	inputs   []func()
+	stopSelf func()
+	updating bool
+	stopped  bool
+}
+
+// scopedBuiltins are builtins acting on the bindings of the scope they are
+// called from. Identifiers resolve to them after the scope's own bindings
+// and before the other builtins.
+var scopedBuiltins map[string]func(env *object.Environment) *object.Builtin
+
+func init() {
+	scopedBuiltins = map[string]func(env *object.Environment) *object.Builtin{
+		"observe": func(env *object.Environment) *object.Builtin {
+			return &object.Builtin{
+				Pure: false,
+				Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+					if err := validateNumberOfArgs(2, args); err != object.NIL {
+						return err
+					}
+					name, ok := args[0].(*object.String)
+					if !ok {
+						return newError("first argument to `observe` must be STRING, got %s", args[0].Type())
+					}
+					switch args[1].(type) {
+					case *object.Function, *object.PureFunction, *object.Builtin:
+					default:
+						return newError("second argument to `observe` must be FUNCTION, got %s", args[1].Type())
+					}
+					if _, ok := env.Get(name.Value); !ok {
+						return newError("identifier not found: " + name.Value)
+					}
+					callback := args[1]
+					env.Watch(name.Value, func(val object.Object) object.Object {
+						return applyFunction(rt, callback, []object.Object{val})
+					})
+					return rt.Copy(object.NIL)
+				},
+			}
+		},
+	}
+}
+
+func evalCellStatement(node *ast.CellStatement, env *object.Environment) object.Object {
+	c := &cell{node: node, env: env}
+	res := c.update()
+	if isError(res) {
+		c.stop()
+		return res
+	}
+	// binding the name some other way, including defining another cell of
+	// the same name, replaces the cell
+	c.stopSelf = env.Watch(node.Name.Value, func(object.Object) object.Object {
+		if !c.updating {
+			c.stop()
+		}
+		return nil
+	})
+	env.Runtime().SetCreatorNode(res, node)
+	return res
+}
+
+// update recomputes the value of the cell and binds it, which in turn
+// updates the cells depending on this one
+func (c *cell) update() object.Object {
+	if c.stopped {
+		return nil
+	}
+	if c.updating {
+		return newError("%s: cell `%s` depends on itself", c.node.Token.Context, c.node.Name.Value)
+	}
+	c.updating = true
+	defer func() { c.updating = false }()
+
+	val := Eval(c.node.Value, c.env)
+	if isError(val) {
+		return val
+	}
+	c.watchInputs(val)
+	return c.env.Set(c.node.Name.Value, val)
+}
+
+func (c *cell) watchInputs(val object.Object) {
+	for _, unwatch := range c.inputs {
+		unwatch()
+	}
+	c.inputs = nil
+	for _, name := range c.inputNames(val) {
+		c.inputs = append(c.inputs, c.env.Watch(name, func(object.Object) object.Object {
+			return c.update()
+		}))
+	}
+}
+
+func (c *cell) inputNames(val object.Object) []string {
+	names := make(map[string]bool)
+	ast.Walk(c.node.Value, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			names[ident.Value] = true
+		}
+		return true
+	})
+
+	if c.env.Runtime().Tracing() {
+		bindings := make(map[object.Object]string)
+		c.env.Each(func(name string, bound object.Object) {
+			bindings[bound] = name
+			// indexing depends on the length and offset of a collection rather
+			// than the collection itself
+			switch bound := bound.(type) {
+			case *object.Array:
+				bindings[&bound.Length] = name
+				bindings[&bound.Offset] = name
+			case *object.Hash:
+				bindings[&bound.Length] = name
+				bindings[&bound.Offset] = name
+			}
+		})
+		for dep := range object.GetAllDependencies(val) {
+			if name, ok := bindings[dep]; ok {
+				names[name] = true
+			}
+		}
+	}
+
+	delete(names, c.node.Name.Value)
+	out := make([]string, 0, len(names))
+	for name := range names {
+		if _, ok := scopedBuiltins[name]; ok {
+			continue
+		}
+		if _, ok := builtins[name]; ok {
+			if _, bound := c.env.Get(name); !bound {
+				continue
+			}
+		}
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (c *cell) stop() {
+	c.stopped = true
+	for _, unwatch := range c.inputs {
+		unwatch()
+	}
+	c.inputs = nil
+	if c.stopSelf != nil {
+		c.stopSelf()
+	}
+}
@@ -0,0 +1,123 @@
+package evaluator
+
+import (
+	"errors"
+	"koko/ast"
+	"koko/lexer"
+	"koko/object"
+	"koko/parser"
+	"strings"
+)
+
+// DiffPrograms runs two versions of a program, or a program reading two
+// different inputs, and compares the dependency graphs of their results.
+// The top level statements of the two programs are paired up, and spans in
+// the old program are moved to where their statement is in the new one, so
+// that values created by the same expression align even when statements
+// were added or removed before it, or the files are named differently.
+func DiffPrograms(oldSource, oldFilename, newSource, newFilename string) (object.GraphDiff, error) {
+	oldGraph, oldProgram, err := programDependencyGraph(oldSource, oldFilename)
+	if err != nil {
+		return object.GraphDiff{}, err
+	}
+	newGraph, newProgram, err := programDependencyGraph(newSource, newFilename)
+	if err != nil {
+		return object.GraphDiff{}, err
+	}
+	alignSpans(oldGraph, oldProgram, oldFilename, newProgram, newFilename)
+	return object.DiffDependencyGraphs(oldGraph, newGraph), nil
+}
+
+func programDependencyGraph(source string, filename string) (object.DependencyGraph, *ast.Program, error) {
+	p := parser.New(lexer.New(source, filename))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return object.DependencyGraph{}, nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	result, _, err := evalSliceTarget(program, 0)
+	if err != nil {
+		return object.DependencyGraph{}, nil, err
+	}
+	return object.GetDependencyGraph(result), program, nil
+}
+
+// alignSpans moves the spans of graph, from the old program, to the new
+// program. Values created in old statements which weren't paired with a new
+// one keep their spans in the old file, so they don't align with anything.
+func alignSpans(graph object.DependencyGraph, old *ast.Program, oldFilename string, updated *ast.Program, newFilename string) {
+	moved := make([]ast.Statement, len(old.Statements))
+	for j, i := range pairStatements(sessionStatements(old), sessionStatements(updated)) {
+		if i >= 0 {
+			moved[i] = updated.Statements[j]
+		}
+	}
+	for _, node := range graph.Nodes {
+		if node.Span == nil || node.Span.File != oldFilename {
+			continue
+		}
+		i := enclosingStatement(old.Statements, node.Span)
+		if i < 0 || moved[i] == nil {
+			continue
+		}
+		from, to := old.Statements[i].Span(), moved[i].Span()
+		if node.Span.Line == from.BeginLine {
+			node.Span.Pos += to.BeginPos - from.BeginPos
+		}
+		node.Span.Line += to.BeginLine - from.BeginLine
+		node.Span.File = newFilename
+	}
+}
+
+// pairStatements pairs the updated statements with old ones like a Session
+// does. The statements left over between two pairs are paired up too: in
+// order when there are as many on both sides, as they were then edited in
+// place, or else by the name they bind.
+func pairStatements(old, updated []*sessionStatement) []int {
+	matches := matchStatements(old, updated)
+	i, j := 0, 0
+	for end := 0; end <= len(updated); end++ {
+		if end < len(updated) && matches[end] < 0 {
+			continue
+		}
+		oldEnd := len(old)
+		if end < len(updated) {
+			oldEnd = matches[end]
+		}
+		if oldEnd-i == end-j {
+			for k := j; k < end; k++ {
+				matches[k] = i + k - j
+			}
+		} else {
+			paired := make(map[int]bool)
+			for k := j; k < end; k++ {
+				for l := i; l < oldEnd; l++ {
+					if !paired[l] && updated[k].binds != "" && updated[k].binds == old[l].binds {
+						matches[k] = l
+						paired[l] = true
+						break
+					}
+				}
+			}
+		}
+		i, j = oldEnd+1, end+1
+	}
+	return matches
+}
+
+// enclosingStatement finds the statement a span is in, or -1 when it is
+// before the first one
+func enclosingStatement(statements []ast.Statement, span *object.GraphSpan) int {
+	found := -1
+	for i, statement := range statements {
+		begin := statement.Span()
+		if begin.Empty() {
+			continue
+		}
+		if begin.BeginLine > span.Line || (begin.BeginLine == span.Line && begin.BeginPos > span.Pos) {
+			break
+		}
+		found = i
+	}
+	return found
+}
@@ -6,9 +6,11 @@ import (
 
 	"fmt"
 	"math"
+	"strings"
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	rt := env.Runtime()
 	switch node := node.(type) {
 
 	case *ast.Program:
@@ -16,13 +18,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		// (Peter) we need this b/c otherwise we crash on comments
 		// TODO come up with a better solution
 		if res != nil {
-			res.SetCreatorNode(node)
+			rt.SetCreatorNode(res, node)
 		}
 		return res
 
 	case *ast.BlockStatement:
 		res := evalBlockStatement(node, env)
-		res.SetCreatorNode(node)
+		rt.SetCreatorNode(res, node)
 		return res
 
 	case *ast.ExpressionStatement:
@@ -30,7 +32,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		// (Peter) we need this b/c otherwise we crash on comments
 		// TODO come up with a better solution
 		if res != nil {
-			res.SetCreatorNode(node)
+			rt.SetCreatorNode(res, node)
 		}
 		return res
 
@@ -40,7 +42,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return val
 		}
 		res := &object.Return{Value: val}
-		res.AddDependency(val)
+		rt.AddDependency(res, val)
 		return res
 
 	case *ast.IntegerLiteral:
@@ -49,20 +51,28 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Float{Value: node.Value, ASTCreator: node}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value, ASTCreator: node}
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
 	case *ast.Boolean:
-		res := nativeBoolToBooleanObject(node.Value)
-		res.SetCreatorNode(node)
+		res := nativeBoolToBooleanObject(rt, node.Value)
+		rt.SetCreatorNode(res, node)
 		return res
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		res := evalPrefixExpression(node.Operator, right)
-		res.SetCreatorNode(node)
+		res := evalPrefixExpression(rt, node.Operator, right)
+		rt.SetCreatorNode(res, node)
 		return res
 	case *ast.InfixExpression:
-		// TODO (Peter) add short circuiting
+		if node.Operator == "&&" || node.Operator == "||" {
+			res := evalLogicalExpression(node, env)
+			if !isError(res) {
+				rt.SetCreatorNode(res, node)
+			}
+			return res
+		}
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -71,21 +81,47 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		res := evalInfixExpression(node.Operator, left, right)
-		res.SetCreatorNode(node)
+		res := evalInfixExpression(rt, node.Operator, left, right)
+		rt.SetCreatorNode(res, node)
 		return res
 	case *ast.IfExpression:
 		res := evalIfExpression(node, env)
-		res.SetCreatorNode(node)
+		rt.SetCreatorNode(res, node)
 		return res
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
+		val = withControlDependencies(rt, val)
+		noteLoopBinding(rt, node.Name.Value, val)
 		res := env.Set(node.Name.Value, val)
-		res.SetCreatorNode(node)
+		rt.SetCreatorNode(res, node)
 		return res
+	case *ast.ConstStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		val = withControlDependencies(rt, val)
+		noteLoopBinding(rt, node.Name.Value, val)
+		res := env.SetConst(node.Name.Value, val, node)
+		rt.SetCreatorNode(res, node)
+		return res
+	case *ast.AssignExpression:
+		res := evalAssignExpression(node, env)
+		rt.SetCreatorNode(res, node)
+		return res
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return &object.Break{ASTCreator: node}
+	case *ast.ContinueStatement:
+		return &object.Continue{ASTCreator: node}
+	case *ast.CellStatement:
+		return evalCellStatement(node, env)
 	case *ast.ImportStatement:
 		// This returns the last statement evaluated, or error if exists
 		loaded := LoadProgramFromFile(node.Value, env)
@@ -95,19 +131,25 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return nil
 	case *ast.Identifier:
 		res := evalIdentifier(node, env)
-		res.SetCreatorNode(node)
+		rt.SetCreatorNode(res, node)
 		return res
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		res := &object.Function{Parameters: params, Env: env, Body: body}
-		res.SetCreatorNode(node)
+		res := &object.Function{Parameters: params, Env: env, Body: body, Checked: rt.PureCalls > 0}
+		rt.SetCreatorNode(res, node)
 		return res
 	case *ast.PureFunctionLiteral:
 		params := node.Parameters
 		body := node.Body
+		resolved, err := checkPurity(params, body, env)
+		if err != nil {
+			return err
+		}
 		res := object.NewPureFunction(params, env, body)
-		res.SetCreatorNode(node)
+		res.Unresolved = !resolved
+		res.FreeNames = freeNames(params, body)
+		rt.SetCreatorNode(res, node)
 		return res
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
@@ -118,16 +160,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		res := applyFunction(function, args)
-		res.SetCreatorNode(node)
+		if err := checkCallPurity(rt, node, function); err != nil {
+			return err
+		}
+		res := applyFunction(rt, function, args)
+		if rt.CallObserver != nil && !isError(res) {
+			rt.CallObserver(node, function, args, res)
+		}
+		rt.SetCreatorNode(res, node)
 		return res
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		res := object.CreateArray(elements)
-		res.SetCreatorNode(node)
+		res := rt.CreateArray(elements)
+		rt.SetCreatorNode(res, node)
 		return res
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
@@ -138,18 +186,27 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(index) {
 			return index
 		}
-		res := evalIndexExpression(left, index)
+		res := evalIndexExpression(rt, left, index)
 		if arrRes, ok := res.(*object.Array); ok {
-			arrRes.Offset.SetCreatorNode(node)
+			rt.SetCreatorNode(&arrRes.Offset, node)
 		}
 		if hashRes, ok := res.(*object.Hash); ok {
-			hashRes.Offset.SetCreatorNode(node)
+			rt.SetCreatorNode(&hashRes.Offset, node)
+		}
+		rt.SetCreatorNode(res, node)
+		return res
+	case *ast.SliceExpression:
+		res := evalSliceExpression(node, env)
+		if arrRes, ok := res.(*object.Array); ok {
+			rt.SetCreatorNode(&arrRes.Offset, node)
+		}
+		if !isError(res) {
+			rt.SetCreatorNode(res, node)
 		}
-		res.SetCreatorNode(node)
 		return res
 	case *ast.HashLiteral:
 		res := evalHashLiteral(node, env)
-		res.SetCreatorNode(node)
+		rt.SetCreatorNode(res, node)
 		return res
 	}
 	return nil
@@ -166,6 +223,8 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break, *object.Continue:
+			return loopSignalError(result)
 		}
 	}
 
@@ -180,7 +239,7 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -188,71 +247,74 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(rt *object.Runtime, operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
-		return evalBangOperatorExpression(right)
+		return evalBangOperatorExpression(rt, right)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return evalMinusPrefixOperatorExpression(rt, right)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
-func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+func evalInfixExpression(rt *object.Runtime, operator string, left object.Object, right object.Object) object.Object {
 	if operator == "==" {
 		// TODO (Peter) in the future make obejct comparisons more granular
-		res := nativeBoolToBooleanObject(left.Equal(right)).Copy()
-		res.AddDependency(left)
-		res.AddDependency(right)
+		res := rt.Copy(nativeBoolToBooleanObject(rt, left.Equal(right)))
+		rt.AddDependency(res, left)
+		rt.AddDependency(res, right)
 		return res
 	} else if operator == "!=" {
-		res := nativeBoolToBooleanObject(!left.Equal(right))
-		res.AddDependency(left)
-		res.AddDependency(right)
+		res := nativeBoolToBooleanObject(rt, !left.Equal(right))
+		rt.AddDependency(res, left)
+		rt.AddDependency(res, right)
 		return res
 	}
+	if isOrderingOperator(operator) && !orderable(left, right) {
+		return newError("can't compare %s %s %s", left.Type(), operator, right.Type())
+	}
 	switch {
 	case left.Type() == object.ARRAY_OBJ:
 		switch {
 		case right.Type() == object.ARRAY_OBJ:
-			return evalArrayInfixExpression(operator, left, right)
+			return evalArrayInfixExpression(rt, operator, left, right)
 		}
 	case left.Type() == object.HASH_OBJ:
 		switch {
 		case right.Type() == object.HASH_OBJ:
-			return evalHashInfixExpression(operator, left, right)
+			return evalHashInfixExpression(rt, operator, left, right)
 		}
 	case left.Type() == object.STRING_OBJ:
 		switch {
 		case right.Type() == object.STRING_OBJ:
-			return evalStringInfixExpression(operator, left, right)
+			return evalStringInfixExpression(rt, operator, left, right)
 		case operator == "*" && right.Type() == object.INTEGER_OBJ:
-			return multiplyStrings(left, right)
+			return multiplyStrings(rt, left, right)
 		case operator == "+":
-			return addStrings(left, right)
+			return addStrings(rt, left, right)
 		}
 	case right.Type() == object.STRING_OBJ:
 		switch {
 		case operator == "*" && left.Type() == object.INTEGER_OBJ:
-			return multiplyStrings(right, left)
+			return multiplyStrings(rt, right, left)
 		case operator == "+":
-			return addStrings(left, right)
+			return addStrings(rt, left, right)
 		}
 	case left.Type() == object.INTEGER_OBJ:
 		switch {
 		case right.Type() == object.INTEGER_OBJ:
-			return evalIntegerInfixExpression(operator, left, right)
+			return evalIntegerInfixExpression(rt, operator, left, right)
 		case right.Type() == object.FLOAT_OBJ:
-			return evalFloatInfixExpression(operator, intToFloat(left), right)
+			return evalFloatInfixExpression(rt, operator, intToFloat(rt, left), right)
 
 		}
 	case left.Type() == object.FLOAT_OBJ:
 		switch {
 		case right.Type() == object.INTEGER_OBJ:
-			return evalFloatInfixExpression(operator, left, intToFloat(right))
+			return evalFloatInfixExpression(rt, operator, left, intToFloat(rt, right))
 		case right.Type() == object.FLOAT_OBJ:
-			return evalFloatInfixExpression(operator, left, right)
+			return evalFloatInfixExpression(rt, operator, left, right)
 		}
 	default:
 		return newError("unknown operator: %s %s %s",
@@ -262,7 +324,7 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 		left.Type(), operator, right.Type())
 }
 
-func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+func evalIntegerInfixExpression(rt *object.Runtime, operator string, left object.Object, right object.Object) object.Object {
 	lVal := left.(*object.Integer).Value
 	rVal := right.(*object.Integer).Value
 	var res object.Object
@@ -277,29 +339,33 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 		// Extra trick: If one number is actually zero we only need to depend on it!
 		// This is a short circuit dependency
 		if lVal == 0 {
-			res.AddDependency(left)
+			rt.AddDependency(res, left)
 			return res
 		} else if rVal == 0 {
-			res.AddDependency(right)
+			rt.AddDependency(res, right)
 			return res
 		}
 	case "/":
-		res = evalFloatInfixExpression(operator, intToFloat(left), intToFloat(right))
+		res = evalFloatInfixExpression(rt, operator, intToFloat(rt, left), intToFloat(rt, right))
 	case "<":
-		res = nativeBoolToBooleanObject(lVal < rVal)
+		res = nativeBoolToBooleanObject(rt, lVal < rVal)
 	case ">":
-		res = nativeBoolToBooleanObject(lVal > rVal)
+		res = nativeBoolToBooleanObject(rt, lVal > rVal)
+	case "<=":
+		res = nativeBoolToBooleanObject(rt, lVal <= rVal)
+	case ">=":
+		res = nativeBoolToBooleanObject(rt, lVal >= rVal)
 	case "%":
 		res = &object.Integer{Value: lVal % rVal}
 	default:
 		return newError("unknown operator for INTEGER %v", operator)
 	}
-	res.AddDependency(left)
-	res.AddDependency(right)
+	rt.AddDependency(res, left)
+	rt.AddDependency(res, right)
 	return res
 }
 
-func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+func evalFloatInfixExpression(rt *object.Runtime, operator string, left object.Object, right object.Object) object.Object {
 	lVal := left.(*object.Float).Value
 	rVal := right.(*object.Float).Value
 
@@ -314,43 +380,54 @@ func evalFloatInfixExpression(operator string, left object.Object, right object.
 		// Extra trick: If one number is actually zero we only need to depend on it!
 		// This is a short circuit dependency
 		if lVal == 0 {
-			res.AddDependency(left)
+			rt.AddDependency(res, left)
 			return res
 		} else if rVal == 0 {
-			res.AddDependency(right)
+			rt.AddDependency(res, right)
 			return res
 		}
 	case "/":
 		res = &object.Float{Value: lVal / rVal}
 	case "<":
-		res = nativeBoolToBooleanObject(lVal < rVal)
+		res = nativeBoolToBooleanObject(rt, lVal < rVal)
 	case ">":
-		res = nativeBoolToBooleanObject(lVal > rVal)
+		res = nativeBoolToBooleanObject(rt, lVal > rVal)
+	case "<=":
+		res = nativeBoolToBooleanObject(rt, lVal <= rVal)
+	case ">=":
+		res = nativeBoolToBooleanObject(rt, lVal >= rVal)
 	case "%":
 		res = &object.Float{Value: math.Mod(lVal, rVal)}
 	default:
 		res = newError("unknown operator for FLOAT %v", operator)
 	}
-	res.AddDependency(left)
-	res.AddDependency(right)
+	rt.AddDependency(res, left)
+	rt.AddDependency(res, right)
 	return res
 }
 
-func intToFloat(integer object.Object) *object.Float {
+func intToFloat(rt *object.Runtime, integer object.Object) *object.Float {
 	res := &object.Float{Value: float64(integer.(*object.Integer).Value)}
-	res.AddDependency(integer)
+	rt.AddDependency(res, integer)
 	return res
 }
 
-func evalStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+func evalStringInfixExpression(rt *object.Runtime, operator string, left object.Object, right object.Object) object.Object {
 	if operator == "+" {
 		// dependency assignment handled inside this function
-		return addStrings(left, right)
+		return addStrings(rt, left, right)
+	}
+	if isOrderingOperator(operator) {
+		// strings are ordered byte by byte, like Go orders them
+		res := orderingResult(rt, operator, strings.Compare(left.(*object.String).Value, right.(*object.String).Value))
+		rt.AddDependency(res, left)
+		rt.AddDependency(res, right)
+		return res
 	}
 	return newError("Unsupported Operator %s for strings", operator)
 }
 
-func multiplyStrings(str object.Object, integer object.Object) *object.String {
+func multiplyStrings(rt *object.Runtime, str object.Object, integer object.Object) *object.String {
 	resStr := ""
 	strVal := str.(*object.String).Value
 	repeats := int(integer.(*object.Integer).Value)
@@ -358,14 +435,14 @@ func multiplyStrings(str object.Object, integer object.Object) *object.String {
 	// a small dependecy optimization; if the integer is 0, the string is irrelevant
 	if repeats <= 0 {
 		res := &object.String{Value: ""}
-		res.AddDependency(integer)
+		rt.AddDependency(res, integer)
 		return res
 	}
 
 	// a small dependecy optimization; if the str is "", then the integer is irrelevant
 	if strVal == "" {
 		res := &object.String{Value: ""}
-		res.AddDependency(str)
+		rt.AddDependency(res, str)
 		return res
 	}
 
@@ -373,75 +450,209 @@ func multiplyStrings(str object.Object, integer object.Object) *object.String {
 		resStr += strVal
 	}
 	res := &object.String{Value: resStr}
-	res.AddDependency(str)
-	res.AddDependency(integer)
+	rt.AddDependency(res, str)
+	rt.AddDependency(res, integer)
 	return res
 }
 
-func addStrings(left object.Object, right object.Object) *object.String {
+func addStrings(rt *object.Runtime, left object.Object, right object.Object) *object.String {
 	res := &object.String{Value: left.String().Value + right.String().Value}
-	res.AddDependency(left)
-	res.AddDependency(right)
+	rt.AddDependency(res, left)
+	rt.AddDependency(res, right)
+	return res
+}
+
+// evalInterpolatedString joins the text of an interpolated string with the
+// String() of each value in it. The result depends on each of those values.
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	rt := env.Runtime()
+	var out strings.Builder
+	values := []object.Object{}
+	for i, part := range node.Parts {
+		if i%2 == 0 {
+			out.WriteString(part.(*ast.StringLiteral).Value)
+			continue
+		}
+		val := Eval(part, env)
+		if isError(val) {
+			return val
+		}
+		out.WriteString(val.String().Value)
+		values = append(values, val)
+	}
+	res := &object.String{Value: out.String(), ASTCreator: node}
+	for _, val := range values {
+		rt.AddDependency(res, val)
+	}
 	return res
 }
 
-func evalArrayInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+func evalArrayInfixExpression(rt *object.Runtime, operator string, left object.Object, right object.Object) object.Object {
 	switch operator {
 	case "+":
-		return addElements(left.(*object.Array), right.(*object.Array))
+		return addElements(rt, left.(*object.Array), right.(*object.Array))
+	case "<", ">", "<=", ">=":
+		return evalArrayComparison(rt, operator, left.(*object.Array), right.(*object.Array))
 	default:
 		return newError("Unsupported Operator %s for arrays", operator)
 	}
 }
 
-func addElements(left *object.Array, right *object.Array) *object.Array {
+// evalArrayComparison orders arrays by their first elements which differ,
+// or, when one array starts with the other, by length. The result depends on
+// the elements compared to find that out, and on the lengths only when they
+// decided it.
+func evalArrayComparison(rt *object.Runtime, operator string, left *object.Array, right *object.Array) object.Object {
+	cmp, deps, err := compareElements(operator, left, right)
+	if err != nil {
+		return err
+	}
+	res := orderingResult(rt, operator, cmp)
+	for _, dep := range deps {
+		rt.AddDependency(res, dep)
+	}
+	return res
+}
+
+func compareElements(operator string, left *object.Array, right *object.Array) (int, []object.Object, *object.Error) {
+	deps := []object.Object{}
+	for i := 0; i < len(left.Elements) && i < len(right.Elements); i++ {
+		l, r := left.Elements[i], right.Elements[i]
+		if !orderable(l, r) {
+			return 0, nil, newError("can't compare %s %s %s in arrays", l.Type(), operator, r.Type())
+		}
+		cmp := 0
+		switch l := l.(type) {
+		case *object.Array:
+			inner, innerDeps, err := compareElements(operator, l, r.(*object.Array))
+			if err != nil {
+				return 0, nil, err
+			}
+			cmp = inner
+			deps = append(deps, innerDeps...)
+		case *object.String:
+			cmp = strings.Compare(l.Value, r.(*object.String).Value)
+			deps = append(deps, l, r)
+		default:
+			cmp = compareNumbers(l, r)
+			deps = append(deps, l, r)
+		}
+		if cmp != 0 {
+			return cmp, deps, nil
+		}
+	}
+	deps = append(deps, &left.Length, &right.Length)
+	return len(left.Elements) - len(right.Elements), deps, nil
+}
+
+func isOrderingOperator(operator string) bool {
+	return operator == "<" || operator == ">" || operator == "<=" || operator == ">="
+}
+
+// orderable reports whether two values can be compared with < and friends:
+// numbers with numbers, strings with strings and arrays with arrays
+func orderable(left object.Object, right object.Object) bool {
+	switch left.Type() {
+	case object.INTEGER_OBJ, object.FLOAT_OBJ:
+		return right.Type() == object.INTEGER_OBJ || right.Type() == object.FLOAT_OBJ
+	case object.STRING_OBJ, object.ARRAY_OBJ:
+		return right.Type() == left.Type()
+	}
+	return false
+}
+
+// compareNumbers returns the sign of l - r. Integers are compared as they
+// are, since not every int64 survives the conversion to float64.
+func compareNumbers(l, r object.Object) int {
+	lInt, lOk := l.(*object.Integer)
+	rInt, rOk := r.(*object.Integer)
+	if lOk && rOk {
+		switch {
+		case lInt.Value < rInt.Value:
+			return -1
+		case lInt.Value > rInt.Value:
+			return 1
+		}
+		return 0
+	}
+	lVal, rVal := numberValue(l), numberValue(r)
+	switch {
+	case lVal < rVal:
+		return -1
+	case lVal > rVal:
+		return 1
+	}
+	return 0
+}
+
+func numberValue(obj object.Object) float64 {
+	if integer, ok := obj.(*object.Integer); ok {
+		return float64(integer.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// orderingResult turns the sign of a comparison into the result of operator
+func orderingResult(rt *object.Runtime, operator string, cmp int) *object.Boolean {
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(rt, cmp < 0)
+	case ">":
+		return nativeBoolToBooleanObject(rt, cmp > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(rt, cmp <= 0)
+	}
+	return nativeBoolToBooleanObject(rt, cmp >= 0)
+}
+
+func addElements(rt *object.Runtime, left *object.Array, right *object.Array) *object.Array {
 	elements := make([]object.Object, 0, len(left.Elements)+len(right.Elements))
 	// NOTE (Peter) this should be okay instead of calling object.CreateArray
 	// But be very careful when changing this for dependency reasons
 	res := object.Array{}
 	for _, el := range left.Elements {
-		elCopy := el.Copy()
-		res.AddDependency(elCopy)
+		elCopy := rt.Copy(el)
+		rt.AddDependency(&res, elCopy)
 		elements = append(elements, elCopy)
 	}
 	for _, el := range right.Elements {
-		elCopy := el.Copy()
+		elCopy := rt.Copy(el)
 		// objects on the right depend on the left array size for their index
 		// if the size of the left array shifts, the objects will change index
 		// they do not depend on the size of the right array
-		elCopy.AddDependency(&left.Length)
+		rt.AddDependency(elCopy, &left.Length)
 		if elArr, ok := elCopy.(*object.Array); ok {
-			elArr.AddOffsetDependency(&left.Length)
+			rt.AddDependency(&elArr.Offset, &left.Length)
 		}
 		if elHash, ok := elCopy.(*object.Hash); ok {
-			elHash.AddOffsetDependency(&left.Length)
+			rt.AddDependency(&elHash.Offset, &left.Length)
 		}
-		res.AddDependency(elCopy)
+		rt.AddDependency(&res, elCopy)
 		elements = append(elements, elCopy)
 	}
 	// TODO (Peter) do we need to do anything with the offsets here???
 	res.Elements = elements
 	res.Length.Value = int64(len(elements))
-	res.Length.AddDependency(&left.Length)
-	res.Length.AddDependency(&right.Length)
+	rt.AddDependency(&res.Length, &left.Length)
+	rt.AddDependency(&res.Length, &right.Length)
 	return &res
 }
 
-func evalHashInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+func evalHashInfixExpression(rt *object.Runtime, operator string, left object.Object, right object.Object) object.Object {
 	lHash := left.(*object.Hash)
 	rHash := right.(*object.Hash)
 
 	switch operator {
 	case "+":
-		return addPairs(lHash, rHash)
+		return addPairs(rt, lHash, rHash)
 	case "-":
-		return subtractPairs(lHash, rHash)
+		return subtractPairs(rt, lHash, rHash)
 	default:
 		return newError("Unsupported Operator %s for hashes", operator)
 	}
 }
 
-func addPairs(left *object.Hash, right *object.Hash) object.Object {
+func addPairs(rt *object.Runtime, left *object.Hash, right *object.Hash) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for k, v := range left.Pairs {
@@ -451,78 +662,111 @@ func addPairs(left *object.Hash, right *object.Hash) object.Object {
 		pairs[k] = v
 	}
 
-	res := object.CreateHash(pairs)
-	res.Length.AddDependency(&left.Length)
-	res.Length.AddDependency(&right.Length)
+	res := rt.CreateHash(pairs)
+	// keys in both hashes are only counted once, so the length depends on
+	// the keys in them, which their lengths stand for
+	rt.AddDependency(&res.Length, &left.Length)
+	rt.AddDependency(&res.Length, &right.Length)
 	return res
 }
 
-func subtractPairs(left *object.Hash, right *object.Hash) object.Object {
+func subtractPairs(rt *object.Runtime, left *object.Hash, right *object.Hash) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for k, v := range left.Pairs {
 		pairs[k] = v
 	}
+	compared := []object.Object{}
 	for k, v := range right.Pairs {
-		if pairs[k].Value.Equal(v.Value) {
-			delete(pairs, k)
+		if pair, ok := pairs[k]; ok {
+			compared = append(compared, pair.Value, v.Value)
+			if pair.Value.Equal(v.Value) {
+				delete(pairs, k)
+			}
 		}
 	}
 
-	res := object.CreateHash(pairs)
-	res.Length.AddDependency(&left.Length)
-	res.Length.AddDependency(&right.Length)
+	res := rt.CreateHash(pairs)
+	rt.AddDependency(&res.Length, &left.Length)
+	rt.AddDependency(&res.Length, &right.Length)
+	// which pairs are removed also depends on the values under the keys the
+	// hashes share
+	for _, val := range compared {
+		rt.AddDependency(&res.Length, val)
+	}
 	return res
 }
 
 // JEM: This is pretty neat
-func evalBangOperatorExpression(right object.Object) object.Object {
-	res := nativeBoolToBooleanObject(!object.Bool(right))
-	res.AddDependency(right)
+func evalBangOperatorExpression(rt *object.Runtime, right object.Object) object.Object {
+	res := nativeBoolToBooleanObject(rt, !object.Bool(right))
+	rt.AddDependency(res, right)
 	return res
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+func evalMinusPrefixOperatorExpression(rt *object.Runtime, right object.Object) object.Object {
 	if right.Type() == object.INTEGER_OBJ {
 		res := &object.Integer{Value: -(right.(*object.Integer).Value)}
-		res.AddDependency(right)
+		rt.AddDependency(res, right)
 		return res
 	} else if right.Type() == object.FLOAT_OBJ {
 		res := &object.Float{Value: -(right.(*object.Float).Value)}
-		res.AddDependency(right)
+		rt.AddDependency(res, right)
 		return res
 	}
 	return newError("unknown operator: -%s", right.Type())
 
 }
 
-func nativeBoolToBooleanObject(input bool) *object.Boolean {
+func nativeBoolToBooleanObject(rt *object.Runtime, input bool) *object.Boolean {
 	if input {
-		return (object.TRUE.Copy()).(*object.Boolean)
+		return rt.Copy(object.TRUE).(*object.Boolean)
 	}
-	return (object.FALSE.Copy()).(*object.Boolean)
+	return rt.Copy(object.FALSE).(*object.Boolean)
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env).Copy()
+	rt := env.Runtime()
+	condition := rt.Copy(Eval(ie.Condition, env))
 	if isError(condition) {
 		return condition
 	}
 	if object.Bool(condition) {
-		res := Eval(ie.Consequence, env).Copy()
-		res.AddDependency(condition)
+		res := rt.Copy(Eval(ie.Consequence, env))
+		rt.AddDependency(res, condition)
 		return res
 	} else if ie.Alternative != nil {
-		res := Eval(ie.Alternative, env).Copy()
-		res.AddDependency(condition)
+		res := rt.Copy(Eval(ie.Alternative, env))
+		rt.AddDependency(res, condition)
 		return res
 	} else {
-		res := object.NIL.Copy()
-		res.AddDependency(condition)
+		res := rt.Copy(object.NIL)
+		rt.AddDependency(res, condition)
 		return res
 	}
 }
 
+// evalLogicalExpression evaluates the right operand of && and || only when
+// the left one doesn't decide the result, and returns the operand which did.
+// The result depends on the operands which were evaluated and no others.
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	rt := env.Runtime()
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if object.Bool(left) == (node.Operator == "||") {
+		return rt.Copy(left)
+	}
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	res := rt.Copy(right)
+	rt.AddDependency(res, left)
+	return res
+}
+
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -538,6 +782,9 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
+	if scoped, ok := scopedBuiltins[node.Value]; ok {
+		return scoped(env)
+	}
 	if builtin, ok := builtins[node.Value]; ok {
 		return builtin
 	}
@@ -561,63 +808,136 @@ func evalExpressions(
 	return result
 }
 
-func evalIndexExpression(left, index object.Object) object.Object {
+func evalIndexExpression(rt *object.Runtime, left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		res := evalArrayIndexExpression(left, index)
-		res.AddDependency(index)
+		res := evalArrayIndexExpression(rt, left, index)
+		rt.AddDependency(res, index)
 		// propegate dependencies
-		res.AddDependency(&left.(*object.Array).Offset)
+		rt.AddDependency(res, &left.(*object.Array).Offset)
 		if arrRes, ok := res.(*object.Array); ok {
-			arrRes.AddOffsetDependency(&left.(*object.Array).Offset)
+			rt.AddDependency(&arrRes.Offset, &left.(*object.Array).Offset)
 		}
 		if hashRes, ok := res.(*object.Hash); ok {
-			hashRes.AddOffsetDependency(&left.(*object.Array).Offset)
+			rt.AddDependency(&hashRes.Offset, &left.(*object.Array).Offset)
 		}
 		return res
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(rt, left.(*object.String), index.(*object.Integer))
 	case left.Type() == object.HASH_OBJ:
-		return evalHashIndexExpression(left, index)
+		return evalHashIndexExpression(rt, left, index)
+	case left.Type() == object.TRACE_OBJ:
+		return evalTraceIndexExpression(rt, left, index)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
 }
 
-func evalArrayIndexExpression(array, index object.Object) object.Object {
+func evalArrayIndexExpression(rt *object.Runtime, array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 
 	// Out of bounds
 	if idx < 0 || idx > max {
-		res := object.NIL.Copy()
-		res.AddDependency(index)
+		res := rt.Copy(object.NIL)
+		rt.AddDependency(res, index)
+		rt.AddDependency(res, &arrayObject.Length)
 		return res
 	}
 
-	res := arrayObject.Elements[idx].Copy()
-	res.AddDependency(index)
+	res := rt.Copy(arrayObject.Elements[idx])
+	rt.AddDependency(res, index)
 	return res
 }
 
-func applyPureFunction(fn *object.PureFunction, args []object.Object) object.Object {
+func applyPureFunction(rt *object.Runtime, fn *object.PureFunction, args []object.Object) object.Object {
 	if len(fn.Parameters) != len(args) {
 		return newError("Supplied %v args, but %v are expected", len(args), len(fn.Parameters))
 	}
 
+	if fn.Unresolved {
+		// names which weren't bound when fn was defined may be by now
+		resolved, err := checkPurity(fn.Parameters, fn.Body, fn.Env)
+		if err != nil {
+			return err
+		}
+		fn.Unresolved = !resolved
+	}
+
+	validatePureFunctionCache(fn)
+	if val, deps, ok := fn.Get(args); ok {
+		return attachCachedResult(rt, val, deps)
+	}
+
 	extendedEnv := extendPureFunctionEnv(fn, args)
-	var res object.Object
-	// TODO (Peter) should we cache errors?
-	if val, ok := fn.Get(args); ok {
-		res = val
-	} else {
-		// this code might be a little inconsistent w.r.t errors?
-		res = unwrapReturnValue(Eval(fn.Body, extendedEnv))
-		fn.Set(args, res)
+	// this code might be a little inconsistent w.r.t errors?
+	rt.PureCalls++
+	res := evalFunctionBody(fn.Body, extendedEnv)
+	rt.PureCalls--
+	// errors don't carry dependencies, so caching them could leak an error
+	// into calls with arguments that would have succeeded
+	if !isError(res) {
+		fn.Set(args, pureFunctionDependencyPaths(rt, args, res), res)
 	}
 	return res
 }
 
-func evalHashIndexExpression(hash, index object.Object) object.Object {
+// pureFunctionDependencyPaths finds the argument sub-parts res depended on.
+// Without tracing there is nothing to go on, so the whole of every argument
+// is taken as a dependency.
+func pureFunctionDependencyPaths(rt *object.Runtime, args []object.Object, res object.Object) []object.DependencyPath {
+	if !rt.Tracing() {
+		paths := make([]object.DependencyPath, 0, len(args))
+		for i := range args {
+			paths = append(paths, object.DependencyPath{Arg: i})
+		}
+		return paths
+	}
+	return object.CollectDependencyPaths(args, object.GetAllDependencies(res))
+}
+
+// attachCachedResult links a cached result to the argument sub-parts of the
+// current call. The cached object still points at the arguments of the call
+// which computed it, so without this the dependencies of the current call
+// would be lost.
+func attachCachedResult(rt *object.Runtime, val object.Object, deps []object.Object) object.Object {
+	if !rt.Tracing() {
+		return val
+	}
+	switch val := val.(type) {
+	case *object.Array:
+		elements := make([]object.Object, 0, len(val.Elements))
+		for _, el := range val.Elements {
+			elements = append(elements, attachCachedResult(rt, el, deps))
+		}
+		res := rt.CreateArray(elements)
+		for _, dep := range deps {
+			rt.AddDependency(&res.Length, dep)
+		}
+		rt.SetCreatorNode(res, val.GetCreatorNode())
+		return res
+	case *object.Hash:
+		pairs := make(map[object.HashKey]object.HashPair)
+		for k, pair := range val.Pairs {
+			pairs[k] = object.HashPair{Key: pair.Key, Value: attachCachedResult(rt, pair.Value, deps)}
+		}
+		res := rt.CreateHash(pairs)
+		for _, dep := range deps {
+			rt.AddDependency(&res.Length, dep)
+		}
+		rt.SetCreatorNode(res, val.GetCreatorNode())
+		return res
+	default:
+		res := val.CopyWithoutDependency()
+		for _, dep := range deps {
+			rt.AddDependency(res, dep)
+		}
+		return res
+	}
+}
+
+func evalHashIndexExpression(rt *object.Runtime, hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
 	if !ok {
@@ -625,38 +945,65 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	}
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
-		res := object.NIL.Copy()
-		res.AddDependency(index)
-		res.AddDependency(&hash.(*object.Hash).Offset)
+		// a missing key depends on the hash's keys, which its length
+		// stands for
+		res := rt.Copy(object.NIL)
+		rt.AddDependency(res, index)
+		rt.AddDependency(res, &hashObject.Length)
+		rt.AddDependency(res, &hash.(*object.Hash).Offset)
 		return res
 	}
-	res := pair.Value.Copy()
-	res.AddDependency(index)
+	res := rt.Copy(pair.Value)
+	rt.AddDependency(res, index)
 	// propegate offset dependencies
 	if arrRes, ok := res.(*object.Array); ok {
-		arrRes.AddOffsetDependency(&hash.(*object.Hash).Offset)
+		rt.AddDependency(&arrRes.Offset, &hash.(*object.Hash).Offset)
 	}
 	if hashRes, ok := res.(*object.Hash); ok {
-		hashRes.AddOffsetDependency(&hash.(*object.Hash).Offset)
+		rt.AddDependency(&hashRes.Offset, &hash.(*object.Hash).Offset)
+	}
+	rt.AddDependency(res, &hash.(*object.Hash).Offset)
+	return res
+}
+
+// evalTraceIndexExpression looks up the "result" or "deps" of a trace, or one
+// of its deps by position
+func evalTraceIndexExpression(rt *object.Runtime, trace, index object.Object) object.Object {
+	traceObject := trace.(*object.Trace)
+	var res object.Object
+	switch index := index.(type) {
+	case *object.String:
+		switch index.Value {
+		case "result":
+			res = rt.Copy(traceObject.Result)
+		case "deps":
+			res = traceObject.DepsArray()
+		default:
+			return newError("unknown trace field: %s, want result or deps", index.Value)
+		}
+	case *object.Integer:
+		res = evalArrayIndexExpression(rt, traceObject.DepsArray(), index)
+	default:
+		return newError("unusable as trace index: %s", index.Type())
 	}
-	res.AddDependency(&hash.(*object.Hash).Offset)
+	rt.AddDependency(res, index)
+	rt.AddDependency(res, trace)
 	return res
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func applyFunction(rt *object.Runtime, fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
 		if len(fn.Parameters) != len(args) {
 			return newError("Supplied %v args, but %v are expected", len(args), len(fn.Parameters))
 		}
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		return evalFunctionBody(fn.Body, extendedEnv)
 	case *object.PureFunction:
-		res := applyPureFunction(fn, args)
+		res := applyPureFunction(rt, fn, args)
 		return res
 	case *object.Builtin:
-		return fn.Fn(args...)
+		return fn.Fn(rt, args...)
 	default:
 		return newError("not a function %s", fn.Type())
 	}
@@ -687,20 +1034,21 @@ func extendPureFunctionEnv(
 	return env
 }
 
-func unwrapReturnValue(obj object.Object) object.Object {
+func unwrapReturnValue(rt *object.Runtime, obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.Return); ok {
 		// TODO Peter this graph is a little over complex
 		res := returnValue.Value.CopyWithoutDependency()
-		res.AddDependency(obj)
+		rt.AddDependency(res, obj)
 		return res
 	}
-	return obj
+	return loopSignalError(obj)
 }
 
 func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
+	rt := env.Runtime()
 	pairs := make(map[object.HashKey]object.HashPair)
 	for keyNode, valueNode := range node.Pairs {
 		key := Eval(keyNode, env)
@@ -720,5 +1068,5 @@ func evalHashLiteral(
 		hashed := hashKey.HashKey()
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
-	return object.CreateHash(pairs)
+	return rt.CreateHash(pairs)
 }
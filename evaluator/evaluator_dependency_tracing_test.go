@@ -1,13 +1,19 @@
 package evaluator
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"koko/ast"
 	"koko/lexer"
 	"koko/object"
 	"koko/parser"
 	"math/rand"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -27,29 +33,16 @@ func strEquals(t *testing.T, testStr string, truthStr string) {
 }
 
 func assertObjectDepsEqual(t *testing.T, res object.Object, expectedDeps []string) {
-	debugTraceObj, ok := res.(*object.DebugTraceMetadata)
+	trace, ok := res.(*object.Trace)
 	if !ok {
-		t.Errorf("Expected Debug Trace Object got %+v\n", res)
+		t.Errorf("Expected Trace Object got %+v\n", res)
 		return
 	}
-	deps := debugTraceObj.DebugMetadata
-	expectedDepsMap := make(map[string]bool)
-	for _, d := range expectedDeps {
-		expectedDepsMap[d] = true
-		ok, val := deps[d]
-		if !(ok && val) {
-			t.Errorf("Expected Dependency %s missing on object %+v\n", d, res)
-			return
-		}
-	}
-	// check that we have no other deps
-	for k, v := range deps {
-		if v {
-			if ok, _ := expectedDepsMap[k]; !ok {
-				t.Errorf("Extra Dependency %s on object %+v\n", k, res)
-				return
-			}
-		}
+	expected := make([]string, len(expectedDeps))
+	copy(expected, expectedDeps)
+	sort.Strings(expected)
+	if strings.Join(trace.Deps, ",") != strings.Join(expected, ",") {
+		t.Errorf("Wrong dependencies on object %s. got=%v, want=%v\n", res.Inspect(), trace.Deps, expected)
 	}
 }
 
@@ -89,6 +82,134 @@ func TestDependencyTrackingInBasicFunctionWithConditionalWithReturn(t *testing.T
 	assertObjectDepsEqual(t, res, []string{"0", "2"})
 }
 
+func TestDependencyTrackingInLogicalOperators(t *testing.T) {
+	tests := []struct {
+		program  string
+		expected []string
+	}{
+		{"let f = fn(a, b) { a && b }; deps(f, false, true)", []string{"0"}},
+		{"let f = fn(a, b) { a && b }; deps(f, true, false)", []string{"0", "1"}},
+		{"let f = fn(a, b) { a || b }; deps(f, 5, 1)", []string{"0"}},
+		{"let f = fn(a, b) { a || b }; deps(f, 0, 1)", []string{"0", "1"}},
+		{"let f = fn(a, b, c) { a[0] > 0 || b[1] > c }; deps(f, [1, 2], [3, 4], 5)", []string{"0|0"}},
+	}
+	for _, tt := range tests {
+		assertObjectDepsEqual(t, testEval(tt.program), tt.expected)
+	}
+}
+
+func TestDependencyTrackingInInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		program  string
+		expected []string
+	}{
+		{`let f = fn(a, b) { "${a} and ${b}" }; deps(f, 1, 2)`, []string{"0", "1"}},
+		{`let f = fn(a, b) { "first is ${a[0]}" }; deps(f, [1, 2], 3)`, []string{"0|0"}},
+		{`let f = fn(a) { "no values" }; deps(f, 1)`, []string{}},
+	}
+	for _, tt := range tests {
+		assertObjectDepsEqual(t, testEval(tt.program), tt.expected)
+	}
+}
+
+func TestDependencyTrackingInStringIndexesAndSlices(t *testing.T) {
+	tests := []struct {
+		program  string
+		expected []string
+	}{
+		{`let f = fn(s, i) { s[i] }; deps(f, "naïve", 2)`, []string{"0", "1"}},
+		{`let f = fn(s, i) { s[i] }; deps(f, "naïve", 9)`, []string{"0", "1"}},
+		{`let f = fn(s, i, j) { s[i:] }; deps(f, "naïve", 1, 3)`, []string{"0", "1"}},
+		{`let f = fn(s, i, j) { s[i:j] }; deps(f, "naïve", 1, 3)`, []string{"0", "1", "2"}},
+	}
+	for _, tt := range tests {
+		assertObjectDepsEqual(t, testEval(tt.program), tt.expected)
+	}
+}
+
+func TestDependencyTrackingInArraySlices(t *testing.T) {
+	tests := []struct {
+		program  string
+		expected []string
+	}{
+		// which element is where depends on the start bound only
+		{`let f = fn(a, i) { a[i:][0] }; deps(f, [1, 2, 3], 1)`, []string{"0|1", "1"}},
+		{`let f = fn(a, j) { a[:j][0] }; deps(f, [1, 2, 3], 2)`, []string{"0|0"}},
+		// the length depends on both bounds, and on the length of the array
+		// when the end bound doesn't decide it
+		{`let f = fn(a, i, j) { len(a[i:j]) }; deps(f, [1, 2, 3], 1, 2)`, []string{"1", "2"}},
+		{`let f = fn(a, i, j) { len(a[i:j]) }; deps(f, [1, 2, 3], 1, 7)`, []string{"0#", "1", "2"}},
+		{`let f = fn(a, i) { a[i:] }; deps(f, [1, 2, 3], 1)`, []string{"0#", "0|1", "0|2", "1"}},
+	}
+	for _, tt := range tests {
+		assertObjectDepsEqual(t, testEval(tt.program), tt.expected)
+	}
+}
+
+func TestDependencyTrackingInArrayComparisons(t *testing.T) {
+	tests := []struct {
+		program  string
+		expected []string
+	}{
+		// only the elements up to the first difference decide the order
+		{"let f = fn(a, b) { a < b }; deps(f, [1, 5, 9], [2, 0])", []string{"0|0", "1|0"}},
+		{"let f = fn(a, b) { a <= b }; deps(f, [1, 5, 9], [1, 6])", []string{"0|0", "0|1", "1|0", "1|1"}},
+		// the lengths only matter when one array starts with the other
+		{"let f = fn(a, b) { a < b }; deps(f, [1], [1, 0])", []string{"0#", "0|0", "1#", "1|0"}},
+	}
+	for _, tt := range tests {
+		assertObjectDepsEqual(t, testEval(tt.program), tt.expected)
+	}
+}
+
+func TestDependencyTrackingInElsifChains(t *testing.T) {
+	program := "let f = fn(a, b, c, d) { if (a) { d } elsif (b) { 2 } elsif (c) { 3 } }; "
+	tests := []struct {
+		args     string
+		expected []string
+	}{
+		// every condition evaluated, and only those, decides the result
+		{"true, false, false, 4", []string{"0", "3"}},
+		{"false, true, false, 4", []string{"0", "1"}},
+		{"false, false, false, 4", []string{"0", "1", "2"}},
+	}
+	for _, tt := range tests {
+		assertObjectDepsEqual(t, testEval(program+"deps(f, "+tt.args+")"), tt.expected)
+	}
+}
+
+func TestDependencyTrackingThroughAssignments(t *testing.T) {
+	tests := []struct {
+		program  string
+		expected []string
+	}{
+		{"let f = fn(a, b) { let x = a; x = b; x }; deps(f, 1, 2)", []string{"1"}},
+		{"let f = fn(a, b) { let x = a; x += b; x }; deps(f, 1, 2)", []string{"0", "1"}},
+		{"let f = fn(a, b, c) { let t = 0; for (x in a) { t += x * c }; t }; deps(f, [1, 2], 5, 3)", []string{"0#", "0|0", "0|1", "2"}},
+	}
+	for _, tt := range tests {
+		assertObjectDepsEqual(t, testEval(tt.program), tt.expected)
+	}
+}
+
+func TestDependencyTrackingThroughIndexAssignments(t *testing.T) {
+	tests := []struct {
+		program  string
+		expected []string
+	}{
+		// elements which weren't replaced keep their own dependencies
+		{"let f = fn(a, b) { a[0] = b; a[1] }; deps(f, [1, 2], 5)", []string{"0|1"}},
+		{"let f = fn(a, b) { a[0] = b; a[0] }; deps(f, [1, 2], 5)", []string{"1"}},
+		{"let f = fn(a, b) { a[0] += b; a[0] }; deps(f, [1, 2], 5)", []string{"0|0", "1"}},
+		{"let f = fn(a, b) { a[0] = b; len(a) }; deps(f, [1, 2], 5)", []string{"0#"}},
+		{"let f = fn(a, b) { a[1][0] = b; a[0] }; deps(f, [1, [2]], 5)", []string{"0|0"}},
+		{"let f = fn(h, v) { h[\"n\"][\"z\"] = v; h[\"m\"] }; deps(f, {\"n\": {\"z\": 1}, \"m\": 3}, 9)", []string{"0|@m"}},
+	}
+	for _, tt := range tests {
+		assertObjectDepsEqual(t, testEval(tt.program), tt.expected)
+	}
+}
+
 func TestDependencyTrackingInSubFunctions(t *testing.T) {
 	program := "let g = fn(a, b) { b }; let f = fn(a, b, c) { g(c, a) }; deps(f, 1, 2, 3)"
 	res := testEval(program)
@@ -226,6 +347,618 @@ func TestStringToArrayConversionForOtherType(t *testing.T) {
 	assertObjectDepsEqual(t, res, []string{"0"})
 }
 
+func TestDependencyGraphJSON(t *testing.T) {
+	program := `let a = {"x": [1, 2]}; let f = fn(h) { h["x"][1] * 3 }; dep_graph_json(f(a))`
+	res := testEval(program)
+	str, ok := res.(*object.String)
+	if !ok {
+		t.Fatalf("expected a string. got=%T (%+v)", res, res)
+	}
+	for i := 0; i < 10; i++ {
+		if testEval(program).Inspect() != str.Value {
+			t.Fatalf("dependency graph export is not stable")
+		}
+	}
+
+	var graph object.DependencyGraph
+	if err := json.Unmarshal([]byte(str.Value), &graph); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+	root := graph.Nodes[0]
+	if root.Type != object.INTEGER_OBJ || root.Value != "6" || root.Creator != "CallExpression" {
+		t.Errorf("wrong root node. got=%+v", root)
+	}
+	literal := false
+	for _, node := range graph.Nodes {
+		if node.Creator == "IntegerLiteral" && node.Value == "2" {
+			literal = true
+			if node.Span == nil || node.Span.Line != 1 {
+				t.Errorf("wrong span for %+v", node)
+			}
+		}
+	}
+	if !literal {
+		t.Errorf("expected the result to depend on the array element. got=%s", str.Value)
+	}
+}
+
+func TestWhyExplainsValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let a = [4, 5, 7];\nlet f = fn(x) { x[2] * 1 };\nwhy(f(a))",
+			[]string{
+				"7 `f(a)` at test_file.koko line 3, pos 6",
+				"  from 7 `(x[2])` at test_file.koko line 2, pos 17, which was `(a[2])` because `a` was argument 0 at test_file.koko line 3, pos 7",
+				"  from 7 `7` at test_file.koko line 1, pos 15",
+			},
+		},
+		{
+			"let b = 3;\nlet h = fn(y) { y * 2 };\nwhy(h(b))",
+			[]string{
+				"6 `h(b)` at test_file.koko line 3, pos 6",
+				"  from 3, the value of `y` at test_file.koko line 2, pos 17",
+				"  from 3, the value of `b` at test_file.koko line 3, pos 7, because `b` was argument 0 for `y`",
+				"  from 3 `let b = 3;` at test_file.koko line 1, pos 0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		res := testEval(tt.input)
+		str, ok := res.(*object.String)
+		if !ok {
+			t.Fatalf("expected a string. got=%T (%+v)", res, res)
+		}
+		strEquals(t, str.Value, strings.Join(tt.expected, "\n"))
+	}
+}
+
+/*
+* TRACE OBJECTS
+ */
+func TestTraceObject(t *testing.T) {
+	trace := "let t = deps(fn(a, b, c) { a[1] + c }, [1, 2], 5, 3);"
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{trace + `t["result"]`, 5},
+		{trace + `len(t)`, 2},
+		{trace + `t[0]`, "0|1"},
+		{trace + `t[1]`, "2"},
+		{trace + `t["deps"][1]`, "2"},
+		{trace + `array(t)[0]`, "0|1"},
+		{trace + `type(t)`, "TRACE"},
+		{trace + `string(t)`, `trace(5, ["0|1", "2"])`},
+		{trace + `t == deps(fn(a, b, c) { c + a[1] }, [7, 2], 6, 3)`, true},
+		{trace + `t == deps(fn(a, b, c) { a[1] + b }, [1, 2], 3, 3)`, false},
+	}
+	for _, tt := range tests {
+		res := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, res, int64(expected))
+		case bool:
+			testBooleanObject(t, res, expected)
+		case string:
+			str, ok := res.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("wrong value for %s. got=%s, want=%s", tt.input, res.Inspect(), expected)
+			}
+		}
+	}
+
+	res := testEval(trace + `t["nope"]`)
+	if !isError(res) {
+		t.Errorf("expected an error for an unknown field. got=%s", res.Inspect())
+	}
+}
+
+/*
+* PROGRAM SLICING
+ */
+func TestSliceProgram(t *testing.T) {
+	program := `let a = [4, 5, 7]
+let unused = 99
+let b = a[0] + 1
+
+let f = fn(x) {
+  let junk = x[1]
+  x[2] * 2
+}
+
+f(a)`
+	tests := []struct {
+		line     int
+		expected string
+	}{
+		{0, `   1 | let a = [4, 5, 7]
+     ...
+   5 | let f = fn(x) {
+     ...
+   7 |   x[2] * 2
+     ...
+  10 | f(a)
+`},
+		{3, `   1 | let a = [4, 5, 7]
+     ...
+   3 | let b = a[0] + 1
+     ...
+`},
+	}
+	for _, tt := range tests {
+		slice, err := SliceProgram(program, "test_file.koko", tt.line)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		strEquals(t, slice, tt.expected)
+	}
+
+	if _, err := SliceProgram(program, "test_file.koko", 4); err == nil {
+		t.Errorf("expected an error slicing an empty line")
+	}
+}
+
+func TestSliceProgramCutsStatements(t *testing.T) {
+	program := `let a = 2; let unused = print(99)
+let f = fn(x) { let junk = print(x); x * 3 }
+let b = 1; f(a)`
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	os.Stdout = w
+	slice, err := SliceProgram(program, "test_file.koko", 0)
+	os.Stdout = stdout
+	w.Close()
+	printed, _ := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	strEquals(t, slice, `   1 | let a = 2;
+   2 | let f = fn(x) { x * 3 }
+   3 | f(a)
+`)
+	if len(printed) != 0 {
+		t.Errorf("expected slicing to print nothing. got=%q", printed)
+	}
+}
+
+func TestDiffPrograms(t *testing.T) {
+	old := "let a = 1\nlet b = 2\nlet f = fn(x) { x + b }\nf(a)"
+
+	diff, err := DiffPrograms(old, "old.koko", old, "new.koko")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !diff.Empty() {
+		t.Errorf("expected no differences. got=\n%s", diff)
+	}
+
+	diff, err = DiffPrograms(old, "old.koko", strings.Replace(old, "2", "5", 1), "new.koko")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	strEquals(t, diff.String(), "~ `f(a)` at new.koko line 4, pos 1: 3 -> 6\n"+
+		"~ `b` at new.koko line 3, pos 21: 2 -> 5\n"+
+		"~ `let b = 2;` at new.koko line 2, pos 1: 2 -> 5\n")
+
+	diff, err = DiffPrograms(old, "old.koko", strings.Replace(old, "x + b", "x * 1", 1), "new.koko")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(diff.Removed) == 0 || len(diff.RemovedEdges) == 0 || len(diff.Added) == 0 {
+		t.Errorf("expected b to disappear and 1 to appear. got=\n%s", diff)
+	}
+	for _, node := range diff.Removed {
+		if node.Source == "1" {
+			t.Errorf("removed a node of the new program: %+v", node)
+		}
+	}
+
+	// statements added before others move them, but their values still align
+	diff, err = DiffPrograms(old, "old.koko", "let z = 0\n\n"+strings.Replace(old, "2", "5", 1), "new.koko")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	strEquals(t, diff.String(), "~ `f(a)` at new.koko line 6, pos 1: 3 -> 6\n"+
+		"~ `b` at new.koko line 5, pos 21: 2 -> 5\n"+
+		"~ `let b = 2;` at new.koko line 4, pos 1: 2 -> 5\n")
+
+	if _, err := DiffPrograms(old, "old.koko", "1 + true", "new.koko"); err == nil {
+		t.Errorf("expected an error diffing a failing program")
+	}
+}
+
+func TestDependencyGraphHTML(t *testing.T) {
+	dir := t.TempDir()
+	// the program is never written to disk, its source is kept when loaded
+	file := filepath.Join(dir, "program.koko")
+	out := filepath.Join(dir, "graph.html")
+	program := "let a = [4, 5, 7]\nlet f = fn(x) {\n  x[2] * 2\n}\nlet res = f(a)\ndep_html(res, \"" + out + "\")"
+
+	res := LoadProgram(program, file, object.NewEnvironment())
+	if res.Type() != object.NIL_OBJ || res == object.NIL {
+		t.Fatalf("expected a copy of nil. got=%s", res.Inspect())
+	}
+	page, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := strings.Index(string(page), "var data = ") + len("var data = ")
+	end := strings.Index(string(page)[start:], ";\n") + start
+	var data htmlGraph
+	if err := json.Unmarshal(page[start:end], &data); err != nil {
+		t.Fatalf("invalid graph data: %s", err)
+	}
+	if data.Files[file] != program {
+		t.Errorf("expected the source of the program. got=%v", data.Files)
+	}
+	if len(data.Clusters) != 1 || data.Clusters[0].Label != "f = fn(x), line 2" {
+		t.Errorf("wrong clusters. got=%+v", data.Clusters)
+	}
+	inFunction := false
+	for _, node := range data.Nodes {
+		if node.Creator == "IndexExpression" && node.Value == "7" {
+			inFunction = true
+			if node.Cluster != 0 || node.EndLine != 3 {
+				t.Errorf("wrong cluster or end line for %+v", node)
+			}
+		}
+	}
+	if !inFunction {
+		t.Errorf("expected the array element in the graph. got=%+v", data.Nodes)
+	}
+	for _, external := range []string{"src=", "href=", "@import"} {
+		if strings.Contains(string(page), external) {
+			t.Errorf("page loads something: found %q", external)
+		}
+	}
+}
+
+func TestDynamicLinter(t *testing.T) {
+	library := `let second = fn(a, b) { b }
+let name = fn(person) { person["name"] }
+let first = pfn(pair) { pair[0] }
+let size = fn(arr) { len(arr) }
+let same = fn(x) { x }
+`
+	linter := NewDynamicLinter()
+	runs := []string{
+		library + `second(1, 2); name({"name": "ann", "age": 3}); first([1, 2]); same([1, 2])`,
+		library + `second(3, 4); first([5, 6]); size([7])`,
+	}
+	for _, run := range runs {
+		if err := linter.Run(run, "lib.koko"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	var out []string
+	for _, finding := range linter.Findings() {
+		out = append(out, finding.String())
+	}
+	strEquals(t, strings.Join(out, "\n"),
+		"lib.koko line 1, pos 16: parameter `a` of `second` never influenced its result in 2 calls\n"+
+			"lib.koko line 2, pos 15: `person[\"age\"]` of `name` never influenced its result in 1 of 1 call\n"+
+			"lib.koko line 3, pos 17: `pair[1]` of `first` never influenced its result in 2 of 2 calls\n"+
+			"lib.koko line 4, pos 15: `arr[0]` of `size` never influenced its result in 1 of 1 call")
+
+	if err := linter.Run("1 + true", "bad.koko"); err == nil {
+		t.Errorf("expected an error running a failing program")
+	}
+}
+
+func TestTaintLabels(t *testing.T) {
+	secrets := `let secret = taint({"key": [1, 2, 3]}, "secret"); let user = taint("bob", "user");`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{secrets + `labels(secret["key"][1] * 2)`, `[secret]`},
+		{secrets + `labels(len(secret["key"]))`, `[secret]`},
+		{secrets + `labels(secret["missing"])`, `[secret]`},
+		// the value of an if depends on its condition
+		{secrets + `labels(if (secret["key"][0] > 0) { 5 } else { 6 })`, `[secret]`},
+		{secrets + `let f = fn(a, b) { a + string(b) }; labels(f(user, secret["key"][2]))`, `[secret, user]`},
+		{secrets + `let f = pfn(a) { a[0] }; f([1, 2]); labels(f(taint([1, 5], "user")))`, `[user]`},
+		{secrets + `labels(5)`, `[]`},
+		{secrets + `sink(user, "secret")`, `bob`},
+	}
+	for _, tt := range tests {
+		res := testEval(tt.input)
+		if res.Inspect() != tt.expected {
+			t.Errorf("wrong value for %s. got=%s, want=%s", tt.input, res.Inspect(), tt.expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{secrets + `print(secret["key"][0] + 1)`, "`print` refused a value labeled \"secret\""},
+		{secrets + `sink(user + "!")`, "`sink` refused a value labeled \"user\""},
+		{secrets + `sink(user, "secret", "user")`, "`sink` refused a value labeled \"user\""},
+		{secrets + `taint(1, 2)`, "second argument to `taint` must be STRING, got INTEGER"},
+	}
+	for _, tt := range errors {
+		res := testEval(tt.input)
+		errObj, ok := res.(*object.Error)
+		if !ok || errObj.Message != tt.expected {
+			t.Errorf("wrong error for %s. got=%s, want=%s", tt.input, res.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestDependencyTrackingInLoops(t *testing.T) {
+	tests := []struct {
+		program  string
+		expected []string
+	}{
+		// values bound in a loop depend on the condition which kept it going
+		{"let f = fn(n, a, c) { let i = 0; let total = 0; while (i < n) { let total = total + a; let i = i + 1 }; total }; deps(f, 3, 2, 7)", []string{"0", "1"}},
+		{"let f = fn(arr, c) { let s = 0; for (x in arr) { let s = s + x }; s }; deps(f, [1, 2], 5)", []string{"0#", "0|0", "0|1"}},
+		{"let f = fn(arr, c) { let s = 0; for (x in arr) { let s = c }; s }; deps(f, [1, 2], 5)", []string{"0#", "1"}},
+		{"let f = fn(h) { let r = \"\"; for (k in h) { let r = r + k }; r }; deps(f, {\"a\": 1})", []string{"0#"}},
+		// and on what made them break out of it
+		{"let f = fn(n) { let i = 0; while (true) { if (i > n) { break }; let i = i + 1 }; i }; deps(f, 3)", []string{"0"}},
+		// a function called in a loop doesn't depend on the loop
+		{"let g = fn(x) { let y = 1; y }; let f = fn(n) { let r = 0; for (x in [1]) { let r = g(x) }; r }; deps(f, 1)", []string{}},
+	}
+	for _, tt := range tests {
+		assertObjectDepsEqual(t, testEval(tt.program), tt.expected)
+	}
+}
+
+/*
+* PURE FUNCTION MEMOIZATION
+ */
+
+func testEvalWithEnv(input string) (object.Object, *object.Environment) {
+	l := lexer.New(input, "test_file.koko")
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	return Eval(program, env), env
+}
+
+func assertCacheSize(t *testing.T, env *object.Environment, name string, expected int) {
+	obj, ok := env.Get(name)
+	if !ok {
+		t.Fatalf("identifier %s not found", name)
+	}
+	fn, ok := obj.(*object.PureFunction)
+	if !ok {
+		t.Fatalf("%s is not a pure function. got=%T", name, obj)
+	}
+	if fn.Cache.Len() != expected {
+		t.Errorf("cache of %s has wrong size. got=%d, want=%d", name, fn.Cache.Len(), expected)
+	}
+}
+
+func TestPureFunctionCacheIgnoresUnusedArgumentParts(t *testing.T) {
+	program := "let f = pfn(a, b) { a[0] + a[1] }; f([1, 2, 3], 4); f([1, 2, 5], 6)"
+	res, env := testEvalWithEnv(program)
+	testIntegerObject(t, res, 3)
+	assertCacheSize(t, env, "f", 1)
+
+	program = "let f = pfn(a, b) { a[0] + a[1] }; f([1, 2, 3], 4); f([1, 7, 3], 4)"
+	res, env = testEvalWithEnv(program)
+	testIntegerObject(t, res, 8)
+	assertCacheSize(t, env, "f", 2)
+}
+
+func TestPureFunctionCacheUsesLengthDependencies(t *testing.T) {
+	program := "let f = pfn(a) { len(a) }; f([1, 2, 3]); f([4, 5, 6])"
+	res, env := testEvalWithEnv(program)
+	testIntegerObject(t, res, 3)
+	assertCacheSize(t, env, "f", 1)
+
+	program = "let f = pfn(a) { len(a) }; f([1, 2, 3]); f([4, 5])"
+	res, env = testEvalWithEnv(program)
+	testIntegerObject(t, res, 2)
+	assertCacheSize(t, env, "f", 2)
+}
+
+func TestPureFunctionCacheUsesKeyDependencies(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = pfn(h) { keys(h) }; f({"a": 1}); f({"b": 1})`, "[b]"},
+		{`let f = pfn(h) { values(h) }; f({"a": 1}); f({"b": 1})[0] + 1`, "2"},
+		{`let f = pfn(h) { len(h + {"a": 0}) }; f({"a": 1}); f({"b": 1})`, "2"},
+		{`let f = pfn(h) { len(h - {"a": 1}) }; f({"a": 1}); f({"b": 1})`, "1"},
+		{`let f = pfn(h) { len(h - {"a": 1}) }; f({"a": 1}); f({"a": 2})`, "1"},
+		{`let f = pfn(h) { h["a"] }; f({"b": 1}); f({"a": 1})`, "1"},
+		{`let f = pfn(h) { let r = ""; for (k in h) { r = r + k }; r }; f({"a": 1}); f({"b": 1})`, "b"},
+	}
+	for _, tt := range tests {
+		if res := testEval(tt.input); res.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. got=%s, want=%s", tt.input, res.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestPureFunctionCacheHitKeepsDependencies(t *testing.T) {
+	program := `
+	let g = pfn(a) { a[0] * 2 };
+	let f = pfn(a) { g(a) };
+	g([5, 1]);
+	f([5, 2]);
+	f([6, 2])`
+	res := testEval(program)
+	testIntegerObject(t, res, 12)
+
+	program = "let g = pfn(a, b) { a[1] }; g([1, 2], 3); deps(g, [4, 2], 5)"
+	res = testEval(program)
+	assertObjectDepsEqual(t, res, []string{"0|1"})
+}
+
+func TestPureFunctionCacheKeysAreStructural(t *testing.T) {
+	program := `let f = pfn(x) { type(x) }; f(1); f("1")`
+	res, env := testEvalWithEnv(program)
+	testStringObject(t, res, "STRING")
+	assertCacheSize(t, env, "f", 2)
+
+	program = `let f = pfn(h) { h }; f({"a": 1, "b": 2, "c": 3}); f({"c": 3, "b": 2, "a": 1})`
+	_, env = testEvalWithEnv(program)
+	assertCacheSize(t, env, "f", 1)
+}
+
+func TestPureFunctionCacheFollowsCapturedValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let k = 1; let f = pfn(x) { x * k }; let a = f(2); let k = 10; [a, f(2)]", "[2, 20]"},
+		{"let k = 1; let g = fn(x) { x * k }; let f = pfn(x) { g(x) }; let a = f(2); let k = 10; [a, f(2)]", "[2, 20]"},
+		{"let k = 1; let h = fn(x) { x * k }; let g = fn(x) { h(x) + h(0) }; let f = pfn(x) { g(x) }; let a = f(2); let k = 10; [a, f(2)]", "[2, 20]"},
+		{"let k = 1; let f = pfn(x) { x * k }; let a = f(2); let k = 1; [a, f(2), cache_stats(f)[\"hits\"]]", "[2, 2, 1]"},
+		// assigning to a captured name, or into it, changes it just the same
+		{"let k = 1; let f = pfn(x) { x * k }; let a = f(2); k = 10; [a, f(2)]", "[2, 20]"},
+		{"let k = 1; let f = pfn(x) { x * k }; let a = f(2); k += 9; [a, f(2)]", "[2, 20]"},
+		{"let k = [1]; let f = pfn(x) { x * k[0] }; let a = f(2); k[0] = 10; [a, f(2)]", "[2, 20]"},
+		{"let k = {\"a\": 1}; let f = pfn(x) { x * k[\"a\"] }; let a = f(2); k[\"a\"] = 10; [a, f(2)]", "[2, 20]"},
+	}
+	for _, tt := range tests {
+		if res := testEval(tt.input); res.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. got=%s, want=%s", tt.input, res.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestPureFunctionCacheDoesNotCacheErrors(t *testing.T) {
+	res, env := testEvalWithEnv("let f = pfn(a) { 1 + a }; f(true)")
+	if !isError(res) {
+		t.Fatalf("expected an error. got=%T (%+v)", res, res)
+	}
+	assertCacheSize(t, env, "f", 0)
+	res = Eval(parser.New(lexer.New("f(2)", "test_file.koko")).ParseProgram(), env)
+	testIntegerObject(t, res, 3)
+}
+
+func TestPureFunctionCacheBuiltins(t *testing.T) {
+	calls := "let f = cache_limit(pfn(a) { a * 2 }, 2); f(1); f(2); f(1); f(3);"
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{calls + `cache_stats(f)["hits"]`, 1},
+		{calls + `cache_stats(f)["misses"]`, 3},
+		{calls + `cache_stats(f)["evictions"]`, 1},
+		{calls + `cache_stats(f)["size"]`, 2},
+		{calls + `cache_stats(f)["limit"]`, 2},
+		{calls + `cache_clear(f); cache_stats(f)["size"]`, 0},
+		{calls + `cache_limit(f, 1); cache_stats(f)["evictions"]`, 2},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	res := testEval(`let f = cache_limit(pfn(a) { a }, 2, "lfu"); cache_stats(f)["policy"]`)
+	if str, ok := res.(*object.String); !ok || str.Value != "lfu" {
+		t.Errorf("wrong policy. got=%s", res.Inspect())
+	}
+	res = testEval(`cache_limit(pfn(a) { a }, 2, "mru")`)
+	if !isError(res) {
+		t.Errorf("expected an error for an unknown policy. got=%s", res.Inspect())
+	}
+	res = testEval("cache_stats(fn(a) { a })")
+	if !isError(res) {
+		t.Errorf("expected an error for an impure function. got=%s", res.Inspect())
+	}
+}
+
+func TestPureFunctionCachePersistsAcrossRuns(t *testing.T) {
+	opts := DefaultEvalOptions
+	opts.CacheDir = t.TempDir()
+	run := func(input string) (object.Object, *object.Environment) {
+		program := parser.New(lexer.New(input, "test_file.koko")).ParseProgram()
+		env := object.NewEnvironment()
+		return EvalWithOptions(program, env, opts), env
+	}
+
+	res, env := run("let f = pfn(a) { a[0] * 2 }; f([3, 4]); f([5, 4])")
+	testIntegerObject(t, res, 10)
+	assertCacheSize(t, env, "f", 2)
+
+	// a fresh run loads both results and hits the first one
+	res, env = run("let f = pfn(a) { a[0] * 2 }; f([3, 9])")
+	testIntegerObject(t, res, 6)
+	assertCacheSize(t, env, "f", 2)
+
+	// editing the body invalidates the results
+	res, env = run("let f = pfn(a) { a[0] * 3 }; f([3, 9])")
+	testIntegerObject(t, res, 9)
+	assertCacheSize(t, env, "f", 1)
+
+	// so does changing a captured value
+	res, env = run("let k = 4; let f = pfn(a) { a[0] * k }; f([3, 9])")
+	testIntegerObject(t, res, 12)
+	res, env = run("let k = 5; let f = pfn(a) { a[0] * k }; f([3, 9])")
+	testIntegerObject(t, res, 15)
+	assertCacheSize(t, env, "f", 1)
+
+	// even when it is bound again after the first call
+	res, _ = run("let k = 1; let f = pfn(x) { x * k }; f(2); let k = 10; f(3)")
+	testIntegerObject(t, res, 30)
+	res, env = run("let k = 1; let f = pfn(x) { x * k }; f(3)")
+	testIntegerObject(t, res, 3)
+	assertCacheSize(t, env, "f", 2)
+}
+
+/*
+* UNTRACED EVALUATION
+ */
+func testEvalUntraced(input string) object.Object {
+	program := parser.New(lexer.New(input, "test_file.koko")).ParseProgram()
+	return EvalWithOptions(program, object.NewEnvironment(), EvalOptions{Trace: false})
+}
+
+func TestUntracedEvaluationSkipsDependencies(t *testing.T) {
+	res := testEvalUntraced("let a = [1, 2, 3]; let f = fn(x) { x[1] * 2 }; f(a)")
+	testIntegerObject(t, res, 4)
+	if len(res.GetDependencyLinks()) != 0 {
+		t.Errorf("expected no dependencies. got=%d", len(res.GetDependencyLinks()))
+	}
+	if traced := testEval("let a = [1, 2]; a[0]"); len(traced.GetDependencyLinks()) == 0 {
+		t.Errorf("expected other environments to still trace dependencies")
+	}
+
+	for _, builtin := range []string{"deps(fn(x) { x }, 1)", "dep_diagraph(1)", "dep_graph_json(1)", "why(1)", "taint(1, \"secret\")"} {
+		res := testEvalUntraced(builtin)
+		if !isError(res) {
+			t.Errorf("expected an error from %s. got=%s", builtin, res.Inspect())
+		}
+	}
+}
+
+func TestUntracedEvaluationLeavesSingletonsAlone(t *testing.T) {
+	creators := []ast.Node{object.TRUE.GetCreatorNode(), object.FALSE.GetCreatorNode(), object.NIL.GetCreatorNode()}
+	testEvalUntraced("let t = true; let f = 1 > 2; let n = if (false) { 1 }; [t, f, n, !t]")
+	for i, singleton := range []object.Object{object.TRUE, object.FALSE, object.NIL} {
+		if singleton.GetCreatorNode() != creators[i] {
+			t.Errorf("untraced evaluation changed the creator of %s to %s",
+				singleton.Inspect(), singleton.GetCreatorNode().String())
+		}
+	}
+}
+
+func TestUntracedPureFunctionsKeyOnWholeArguments(t *testing.T) {
+	res := testEvalUntraced("let f = pfn(a) { a[0] }; f([1, 2]); f([1, 3])")
+	testIntegerObject(t, res, 1)
+	res = testEvalUntraced("let f = pfn(a) { a[0] }; f([1, 2]); f([5, 2])")
+	testIntegerObject(t, res, 5)
+	res = testEvalUntraced("let f = pfn(a) { a[0] }; f([1, 2]); cache_stats(f)[\"hits\"] + f([1, 2]) + cache_stats(f)[\"hits\"]")
+	testIntegerObject(t, res, 2)
+}
+
 /**
 This section contains larger "integration tests".
 **/
@@ -4,6 +4,7 @@ import (
 	"koko/lexer"
 	"koko/object"
 	"koko/parser"
+	"strings"
 	"testing"
 )
 
@@ -57,6 +58,11 @@ func TestEvalStringExpression(t *testing.T) {
 	}{
 		{"\"Hello, koko\"", "Hello, koko"},
 		{"\"5.1\"", "5.1"},
+		{"\"a\\tb\\n\\\"c\\\"\"", "a\tb\n\"c\""},
+		{"`raw\nstring \\n`", "raw\nstring \\n"},
+		{`let n = 2; "${n} + ${n} is ${n + n}"`, "2 + 2 is 4"},
+		{`"${[1, "a"]} ${true} ${1.5} ${"${"nested"}"}"`, "[1, a] true 1.5 nested"},
+		{"`${raw}` + \"\\${escaped}\"", "${raw}${escaped}"},
 	}
 
 	for _, tt := range tests {
@@ -143,6 +149,28 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 <= 2", true},
+		{"2 >= 2.0", true},
+		{"\"apple\" < \"banana\"", true},
+		{"\"b\" <= \"a\"", false},
+		{"\"ab\" > \"a\"", true},
+		{"\"a\" >= \"a\"", true},
+		{"\"Z\" < \"a\"", true},
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 2] > [1, 3]", false},
+		{"[1, 2] < [1, 2, 0]", true},
+		{"[] < [1]", true},
+		{"[1, 2] <= [1, 2]", true},
+		{"[1, 2] >= [1, 2]", true},
+		{"[2] > [1, 100]", true},
+		{"[[1, \"b\"]] > [[1, \"a\"], 5]", true},
+		{"[9007199254740993] > [9007199254740992]", true},
+		{"[9007199254740992] < [9007199254740993]", true},
+		{"[1.5] < [2]", true},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -206,6 +234,79 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestComparisonErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 < \"a\"", "can't compare INTEGER < STRING"},
+		{"\"a\" >= 1", "can't compare STRING >= INTEGER"},
+		{"true <= false", "can't compare BOOLEAN <= BOOLEAN"},
+		{"{1: 1} > {1: 1}", "can't compare HASH > HASH"},
+		{"[1, 2] < [1, \"a\"]", "can't compare INTEGER < STRING in arrays"},
+		// elements after the first difference aren't compared
+		{"[1, 2] < [2, \"a\"]", ""},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if tt.expectedMessage == "" {
+			if ok {
+				t.Errorf("unexpected error for %q: %s", tt.input, errObj.Message)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && false", false},
+		{"true && true", true},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		// operands are returned as they are, not converted to booleans
+		{"0 || 5", 5},
+		{"3 && 5", 5},
+		{"0 && 5", 0},
+		{"\"\" || \"default\"", "default"},
+		{"\"set\" || \"default\"", "set"},
+		// the right operand isn't evaluated when the left one decides
+		{"false && missing", false},
+		{"true || missing", true},
+		{"let f = fn() { 1 / 0 }; true || f()", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	evaluated := testEval("true && missing")
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "identifier not found: missing" {
+		t.Errorf("expected an error for an undefined right operand. got=%s", evaluated.Inspect())
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -224,6 +325,11 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (\"a\") { 10 } else { 20 }", 10},
 		{"if (\"\") { 10 } else { 20 }", 20},
 		{"if (0) { 10 } else { 20 }", 20},
+		{"if (false) { 10 } elsif (true) { 20 } else { 30 }", 20},
+		{"if (false) { 10 } elsif (false) { 20 } else { 30 }", 30},
+		{"if (false) { 10 } elsif (false) { 20 }", nil},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } elsif (3 > 2) { 30 } else { 40 }", 30},
+		{"if (true) { 10 } elsif (missing) { 20 }", 10},
 	}
 
 	for _, tt := range tests {
@@ -325,6 +431,14 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "koko"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			`{"a": 1}[0:1]`,
+			"slice operator not supported: HASH",
+		},
+		{
+			`"koko"[1:"2"]`,
+			"slice bounds must be INTEGER, got STRING",
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -355,6 +469,128 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 5; a = 10; a", 10},
+		{"let a = 5; a = 10", 10},
+		{"let a = 5; a += 2; a", 7},
+		{"let a = 5; a -= 2; a", 3},
+		{"let a = 5; a *= 2; a", 10},
+		{"let s = \"a\"; s += \"b\"; s", "ab"},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		// assignment updates the binding a closure captured, where let shadows it
+		{"let make = fn() { let count = 0; fn() { count += 1 } }; let c = make(); c(); c(); c()", 3},
+		{"let n = 1; let f = fn() { n = n * 10 }; f(); f(); n", 100},
+		{"let n = 1; let f = fn() { let n = 5; n = 6 }; f(); n", 1},
+		// the right hand side sees the value from before the assignment
+		{"let n = 1; let f = fn() { n = 10; 1 }; n += f(); n", 2},
+		{"const k = 5; k * 2", 10},
+		{"const k = 5; let f = fn() { let k = 6; k }; f()", 6},
+		// a const statement in a loop binds its constant again on every iteration
+		{"let t = 0; for (x in [1, 2]) { const k = x * 2; t += k }; t", 6},
+		{"let i = 0; while (i < 3) { const k = i; i += 1 }; k", 2},
+		{"let a = 1; cell b = a * 2; a = 4; b", 8},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"x = 1", "identifier not found: x"},
+		{"x += 1", "identifier not found: x"},
+		{"let f = fn() { y = 1 }; f()", "identifier not found: y"},
+		{"const k = 1; k = 2", "can't assign to constant `k`"},
+		{"const k = 1; k += 2", "can't assign to constant `k`"},
+		{"const k = 1; let f = fn() { k = 2 }; f()", "can't assign to constant `k`"},
+		{"const k = 1; let k = 2", "can't bind constant `k` again"},
+		{"const k = 1; const k = 2", "can't bind constant `k` again"},
+		{"for (x in [1, 2]) { const k = x; k = 5 }", "can't assign to constant `k`"},
+		{"for (x in [1, 2]) { const k = x; const k = 3 }", "can't bind constant `k` again"},
+		{"for (x in [1, 2]) { let k = x; const k = 3 }", "can't bind constant `k` again"},
+		{"let x = true; x += 1", "unknown operator: BOOLEAN + INTEGER"},
+		{"let x = 1; x = missing", "identifier not found: missing"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestIndexAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1, 2, 3]; a[0] = 10; a", "[10, 2, 3]"},
+		{"let a = [1, 2, 3]; a[2] += 1", "4"},
+		{"let h = {\"x\": 1}; h[\"x\"] *= 5; h[\"y\"] = 2; h[\"x\"] + h[\"y\"]", "7"},
+		{"let grid = [[0, 0], [0, 0]]; grid[1][0] = 7; grid", "[[0, 0], [7, 0]]"},
+		{"let h = {\"a\": [1, 2]}; h[\"a\"][1] = 5; h[\"a\"]", "[1, 5]"},
+		// values are copied on write, so other bindings keep the old value
+		{"let a = [1, 2]; let b = a; a[0] = 3; b", "[1, 2]"},
+		{"let a = [[1]]; let inner = a[0]; a[0][0] = 2; inner", "[1]"},
+		{"let a = [1, 2]; let f = fn(arr) { arr[0] = 9; arr }; f(a); a", "[1, 2]"},
+		{"let a = [1, 2]; let f = fn() { a[0] = 9 }; f(); a", "[9, 2]"},
+		{"let c = [0, 0, 0]; for (i in [0, 1, 2]) { c[i] = i * i }; c", "[0, 1, 4]"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong value for %s. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let a = [1]; a[1] = 2", "index 1 out of range for array of length 1"},
+		{"let a = [1]; a[-1] = 2", "index -1 out of range for array of length 1"},
+		{"let a = [[1]]; a[0][5] = 1", "index 5 out of range for array of length 1"},
+		{"let a = [1]; a[\"x\"] = 2", "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[[1]] = 2", "unusable as hash key: ARRAY"},
+		{"let s = \"ab\"; s[0] = \"c\"", "index assignment not supported: STRING"},
+		{"const a = [1]; a[0] = 2", "can't assign to constant `a`"},
+		{"b[0] = 1", "identifier not found: b"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
@@ -407,6 +643,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
 		{`len(1)`, 1},
+		{`len("naïve 😀")`, 7},
+		{`len(array("日本語"))`, 3},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
 
@@ -428,6 +666,34 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestStringIndexAndSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"koko"[0]`, "k"},
+		{`"naïve 😀"[2]`, "ï"},
+		{`"naïve 😀"[6]`, "😀"},
+		{`"koko"[4]`, nil},
+		{`"koko"[-1]`, nil},
+		{`"naïve 😀"[1:5]`, "aïve"},
+		{`"naïve 😀"[:2]`, "na"},
+		{`"naïve 😀"[6:]`, "😀"},
+		{`"koko"[:]`, "koko"},
+		{`"koko"[-2:10]`, "koko"},
+		{`"koko"[3:1]`, ""},
+		{`let s = "日本語"; s[len(s) - 1]`, "語"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if str, ok := tt.expected.(string); ok {
+			testStringObject(t, evaluated, str)
+		} else {
+			testNilObject(t, evaluated)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	evaluated := testEval(input)
@@ -501,8 +767,29 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestArraySliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3][:]", "[1, 2, 3]"},
+		{"[1, 2, 3][-2:10]", "[1, 2, 3]"},
+		{"[1, 2, 3][2:1]", "[]"},
+		{"[1, [2, 3], 4][1:2][0][1]", "3"},
+		{"let a = [1, 2, 3]; let b = a[1:]; b[0] = 5; a", "[1, 2, 3]"},
+	}
+	for _, tt := range tests {
+		if evaluated := testEval(tt.input); evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestArrayUnsupportedOpError(t *testing.T) {
-	forbiddenExpressions := []string{"[1] * [2]", "[1] - [2]", "[1] / [2]", "[1] > [2]", "[1] < [2]"}
+	forbiddenExpressions := []string{"[1] * [2]", "[1] - [2]", "[1] / [2]", "[1] > [\"a\"]", "[true] < [false]"}
 	for _, e := range forbiddenExpressions {
 		evaluated := testEval(e)
 		if !isError(evaluated) {
@@ -599,3 +886,318 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestPureFunctionPurityChecks(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"pfn(x) { print(x) }",
+			"test_file.koko line 1: pure function can't call impure builtin `print`",
+		},
+		{
+			"pfn(x) { x + rando(10) }",
+			"test_file.koko line 1: pure function can't call impure builtin `rando`",
+		},
+		{
+			"let log = fn(x) { print(x) }\nlet f = pfn(x) { log(x) }",
+			"test_file.koko line 2: pure function can't call impure function `log`, " +
+				"test_file.koko line 1: pure function can't call impure builtin `print`",
+		},
+		{
+			"let p = print; pfn(x) { p(x) }",
+			"test_file.koko line 1: pure function can't call impure builtin `p`",
+		},
+		{
+			"pfn(x) { observe(\"x\", fn(v) { v }) }",
+			"test_file.koko line 1: pure function can't call impure builtin `observe`",
+		},
+		{
+			"let total = 0; pfn(x) { total += x }",
+			"test_file.koko line 1: pure function can't assign to `total`",
+		},
+		{
+			"let seen = {}; pfn(x) { seen[x] = true }",
+			"test_file.koko line 1: pure function can't assign to `seen`",
+		},
+		{
+			"let total = 0; let add = fn(x) { total = total + x }; pfn(x) { add(x) }",
+			"test_file.koko line 1: pure function can't call impure function `add`, " +
+				"test_file.koko line 1: pure function can't assign to `total`",
+		},
+		{
+			"pfn(x) { let g = fn(print) { print }; print(x) }",
+			"test_file.koko line 1: pure function can't call impure builtin `print`",
+		},
+		{
+			"let total = 0; pfn(x) { let g = fn(total) { total }; total = x }",
+			"test_file.koko line 1: pure function can't assign to `total`",
+		},
+		{
+			"let f = pfn(x) { g(x) }; let g = fn(x) { print(x) }; f(3)",
+			"test_file.koko line 1: pure function can't call impure function `g`, " +
+				"test_file.koko line 1: pure function can't call impure builtin `print`",
+		},
+		{
+			"let log = fn(x) { print(x) }\nlet f = pfn(g, x) { g(x) }\nf(log, 1)",
+			"test_file.koko line 2: pure function can't call impure function `g`, " +
+				"test_file.koko line 1: pure function can't call impure builtin `print`",
+		},
+		{
+			"let f = pfn(g, x) { g(x) }; f(print, 1)",
+			"test_file.koko line 1: pure function can't call impure builtin `g`",
+		},
+		{
+			"let h = {\"log\": fn(x) { print(x) }}; let f = pfn(x) { h[\"log\"](x) }; f(1)",
+			"test_file.koko line 1: pure function can't call impure function `(h[\"log\"])`, " +
+				"test_file.koko line 1: pure function can't call impure builtin `print`",
+		},
+		{
+			"let fs = [rando]; let f = pfn(x) { fs[0](x) }; f(3)",
+			"test_file.koko line 1: pure function can't call impure builtin `(fs[0])`",
+		},
+		{
+			"pfn(x) { import \"library/standard.koko\"; x }",
+			"test_file.koko line 1: pure function can't import `library/standard.koko`",
+		},
+		{
+			"let load = fn() { import \"library/standard.koko\" }; pfn(x) { load(); x }",
+			"test_file.koko line 1: pure function can't call impure function `load`, " +
+				"test_file.koko line 1: pure function can't import `library/standard.koko`",
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestPureFunctionsCanCallPureCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = pfn(x) { len(string(x)) }; f(123)", 3},
+		{"let double = fn(x) { x * 2 }; let f = pfn(x) { double(x) }; f(4)", 8},
+		{"let f = pfn(x) { let print = fn(y) { y }; print(x) }; f(5)", 5},
+		{"let fact = pfn(x) { if (x < 2) { 1 } else { x * fact(x - 1) } }; fact(5)", 120},
+		{"let print = 2; let f = pfn(xs) { let t = 0; for (print in xs) { let t = t + print }; t }; f([1, 2, 3])", 6},
+		{"let f = pfn(xs) { let t = 0; for (x in xs) { t += x }; t }; f([1, 2, 3])", 6},
+		{"let f = pfn(xs) { xs[0] = 5; xs[0] + xs[1] }; f([1, 2, 3])", 7},
+		{"let f = pfn(x) { let n = 0; let add = fn(y) { n += y }; add(x); add(x); n }; f(3)", 6},
+		{"let f = pfn(x) { helper(x) }; let helper = fn(x) { x * 2 }; f(3) + f(3)", 12},
+		{"let even = fn(x) { if (x == 0) { 1 } else { odd(x - 1) } }; let odd = fn(x) { if (x == 0) { 0 } else { even(x - 1) } }; let f = pfn(x) { even(x) }; f(4)", 1},
+		{"let f = pfn(g, x) { g(x) }; f(fn(y) { y * 2 }, 4) + f(len, \"abc\")", 11},
+		{"let fs = {\"double\": fn(y) { y * 2 }}; let f = pfn(x) { fs[\"double\"](x) }; f(4)", 8},
+		{"let sum = fn(x) { let t = 0; let add = fn(y) { t += y }; add(x); add(x); t }; let f = pfn(x) { sum(x) }; f(3)", 6},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestCells(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 1; cell b = a + 1; b", 2},
+		{"let a = 1; cell b = a + 1; let a = 5; b", 6},
+		{"let a = 1; cell b = a * 2; cell c = b + 1; let a = 10; c", 21},
+		// k is only read inside f, found through the dependency graph
+		{"let k = 1; let f = fn(x) { x + k }; cell c = f(1); let k = 10; c", 11},
+		{"let f = fn(x) { x }; cell c = f(1); let f = fn(x) { x * 3 }; c", 3},
+		{"let arr = [1, 2]; let second = fn() { arr[1] }; cell c = second(); let arr = [1, 7]; c", 7},
+		{"let flag = true; let a = 1; let b = 2; cell c = if (flag) { a } else { b }; let flag = false; let b = 5; c", 5},
+		// binding the name of a cell with let replaces the cell
+		{"let a = 1; cell b = a; let b = 100; let a = 2; b", 100},
+		{"let a = 1; cell b = a; cell b = a * 10; let a = 2; b", 20},
+		{"let a = 1; let f = fn() { let a = 50; a }; cell b = a + f(); let a = 2; b", 52},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestObserveReturnsFreshNil(t *testing.T) {
+	res := testEval("let a = 1; observe(\"a\", fn(v) { v })")
+	testNilObject(t, res)
+	if res == object.NIL {
+		t.Errorf("expected a copy of nil, so its creator isn't shared")
+	}
+}
+
+func TestCellErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"cell b = a + 1", "identifier not found: a"},
+		{"let a = 1; cell b = a + 1; let a = true; b", "unknown operator: BOOLEAN + INTEGER"},
+		{
+			"let a = 1; cell b = a + 1; cell a = b + 1",
+			"test_file.koko line 1: cell `a` depends on itself",
+		},
+		{
+			"let a = 1; cell b = a + 1; observe(\"b\", fn(v) { if (v == 3) { v + true } else { v } }); let a = 2",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{"observe(\"b\", fn(v) { v })", "identifier not found: b"},
+		{"let b = 1; observe(b, fn(v) { v })", "first argument to `observe` must be STRING, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	input := `
+let a = 1
+cell b = a + 1
+observe("b", fn(v) { if (v == 3) { v + true } else { v } })
+let a = 3
+b`
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestObserveLoopWhichBreaks(t *testing.T) {
+	// breaking out of a loop doesn't bind the names the loop bound again
+	input := `
+let i = 0
+let calls = 0
+observe("i", fn(v) { calls += 1 })
+while (true) { if (i == 3) { break }; let i = i + 1 }
+calls`
+	testIntegerObject(t, testEval(input), 3)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; while (i < 10) { let i = i + 1 }; i", 10},
+		{"let i = 0; while (false) { let i = i + 1 }; i", 0},
+		{"let i = 0; let total = 0; while (i < 5) { let i = i + 1; if (i == 2) { continue }; let total = total + i }; total", 13},
+		{"let i = 0; while (true) { if (i == 3) { break }; let i = i + 1 }; i", 3},
+		{"while (true) { const c = 1; break }; c", 1},
+		{"let total = 0; for (x in [1, 2, 3]) { let total = total + x }; total", 6},
+		{"let total = 0; for (x in []) { let total = total + 1 }; total", 0},
+		{"let out = 0; for (k in {\"b\": 1, \"a\": 2, \"c\": 3}) { if (k == \"b\") { break }; let out = out + 1 }; out", 1},
+		{"let n = 0; for (c in \"héllo\") { let n = n + 1 }; n", 5},
+		{"let t = deps(fn(a) { a[0] + a[1] }, [1, 2, 3]); let n = 0; for (d in t) { let n = n + 1 }; n", 2},
+		// break and continue only apply to the innermost loop
+		{"let total = 0; for (x in [1, 2]) { for (y in [10, 20]) { if (y == 20) { break }; let total = total + x * y } }; total", 30},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x } }; 0 }; f([1, 5, 9])", 5},
+		// a loop over thousands of elements doesn't grow the Go stack
+		{"let i = 0; while (i < 5000) { let i = i + 1 }; i", 5000},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"break", "break outside of a loop"},
+		{"if (true) { continue }", "continue outside of a loop"},
+		{"let f = fn() { break }; while (true) { f() }", "break outside of a loop"},
+		{"for (x in 5) { x }", "test_file.koko line 1: can't loop over INTEGER"},
+		{"while (x) { 1 }", "identifier not found: x"},
+		{"for (x in [1, 2]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestSessionUpdate(t *testing.T) {
+	session := NewSession("test_file.koko")
+	update := func(source string) *UpdateResult {
+		res, err := session.Update(source)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return res
+	}
+
+	res := update("let a = 1; let b = 10; let f = fn(x) { x + a }; let c = f(b); c")
+	testIntegerObject(t, res.Result, 11)
+	if res.Evaluated != 5 {
+		t.Errorf("first update evaluated %d statements, want 5", res.Evaluated)
+	}
+
+	tests := []struct {
+		source    string
+		expected  int64
+		changed   string
+		evaluated int
+	}{
+		// only b, and c which uses it, are evaluated again
+		{"let a = 1; let b = 20; let f = fn(x) { x + a }; let c = f(b); c", 21, "b,c", 3},
+		// a is only used inside f, which has to be evaluated again too
+		{"let a = 2; let b = 20; let f = fn(x) { x + a }; let c = f(b); c", 22, "a,f,c", 4},
+		// unchanged source evaluates nothing
+		{"let a = 2; let b = 20; let f = fn(x) { x + a }; let c = f(b); c", 22, "", 0},
+		// inserting a statement doesn't disturb the others
+		{"let a = 2; let z = 5; let b = 20; let f = fn(x) { x + a }; let c = f(b); c", 22, "z", 1},
+		// removing a binding re-evaluates its users
+		{"let a = 2; let b = 20; let f = fn(x) { x + a }; let c = f(b); c + z", 0, "z", 1},
+		// binding a name twice evaluates everything
+		{"let a = 2; let b = 20; let f = fn(x) { x + a }; let c = f(b); let a = 3; c", 22, "a,b,f,c", 6},
+		// so does a loop, which can bind any number of names
+		{"let a = 2; let b = 20; let f = fn(x) { x + a }; let c = f(b); while (c < 25) { let c = c + 1 }; c", 25, "a,b,f,c", 6},
+		// and so does assigning to a name anywhere
+		{"let a = 2; let b = 20; let f = fn(x) { a += x }; let c = f(b); c", 22, "a,b,f,c", 5},
+	}
+	for _, tt := range tests {
+		res := update(tt.source)
+		if tt.expected == 0 {
+			if !isError(res.Result) {
+				t.Errorf("expected an error for %q. got=%s", tt.source, res.Result.Inspect())
+			}
+		} else {
+			testIntegerObject(t, res.Result, tt.expected)
+		}
+		if strings.Join(res.Changed, ",") != tt.changed {
+			t.Errorf("wrong bindings changed for %q. got=%v, want=%s", tt.source, res.Changed, tt.changed)
+		}
+		if res.Evaluated != tt.evaluated {
+			t.Errorf("wrong number of statements evaluated for %q. got=%d, want=%d", tt.source, res.Evaluated, tt.evaluated)
+		}
+	}
+
+	if _, err := session.Update("let = ;"); err == nil {
+		t.Errorf("expected a parser error")
+	}
+}
@@ -2,12 +2,50 @@ package evaluator
 
 import (
 	"io/ioutil"
+	"koko/ast"
 	"koko/lexer"
 	"koko/object"
 	"koko/parser"
 	"strings"
 )
 
+// EvalOptions configures how a program is evaluated. The options are set on
+// the runtime of the environment a program is evaluated in, so they stay in
+// effect for whatever is evaluated in it later, e.g. imports, and don't
+// affect programs evaluated in other environments.
+type EvalOptions struct {
+	// Trace records the dependencies of every value. Without it evaluation
+	// is faster, but builtins which look at dependencies return errors and
+	// pure functions can only reuse results for identical arguments.
+	Trace bool
+	// CacheDir is where pure functions keep their results across runs.
+	// Persistence is off while it is empty.
+	CacheDir string
+	// CacheLimit bounds the number of results cached by all pure functions
+	// together, evicting them by CachePolicy. A limit of 0 means unbounded.
+	CacheLimit  int
+	CachePolicy object.EvictionPolicy
+}
+
+// DefaultEvalOptions traces dependencies, like Eval does
+var DefaultEvalOptions = EvalOptions{Trace: true}
+
+// apply sets opts on the runtime of env
+func (opts EvalOptions) apply(env *object.Environment) {
+	rt := env.Runtime()
+	rt.SetTracing(opts.Trace)
+	rt.CacheDir = opts.CacheDir
+	if limit, policy := rt.CacheLimit(); limit != opts.CacheLimit || policy != opts.CachePolicy {
+		rt.SetCacheLimit(opts.CacheLimit, opts.CachePolicy)
+	}
+}
+
+// EvalWithOptions evaluates a node like Eval, with opts in effect
+func EvalWithOptions(node ast.Node, env *object.Environment, opts EvalOptions) object.Object {
+	opts.apply(env)
+	return Eval(node, env)
+}
+
 func LoadProgramFromFile(fileLocation string, env *object.Environment) object.Object {
 	data, err := ioutil.ReadFile(fileLocation)
 
@@ -18,8 +56,12 @@ func LoadProgramFromFile(fileLocation string, env *object.Environment) object.Ob
 }
 
 func ExecuteProgram(programStr string) string {
+	return ExecuteProgramWithOptions(programStr, DefaultEvalOptions)
+}
+
+func ExecuteProgramWithOptions(programStr string, opts EvalOptions) string {
 	env := object.NewEnvironment()
-	evaluated := LoadProgram(programStr, "", env)
+	evaluated := LoadProgramWithOptions(programStr, "", env, opts)
 
 	if evaluated != nil {
 		return evaluated.Inspect()
@@ -27,6 +69,14 @@ func ExecuteProgram(programStr string) string {
 	return ""
 }
 
+// LoadProgramWithOptions evaluates a program with opts in effect
+func LoadProgramWithOptions(programStr string, filename string, env *object.Environment, opts EvalOptions) object.Object {
+	opts.apply(env)
+	return LoadProgram(programStr, filename, env)
+}
+
+// LoadProgram evaluates a program with the options currently in effect.
+// Programs loaded from a file are kept on the runtime of env.
 func LoadProgram(programStr string, filename string, env *object.Environment) object.Object {
 	l := lexer.New(programStr, filename)
 	p := parser.New(l)
@@ -35,6 +85,10 @@ func LoadProgram(programStr string, filename string, env *object.Environment) ob
 	if len(p.Errors()) != 0 {
 		return newError(strings.Join(p.Errors(), "\n"))
 	}
+	if filename != "" {
+		rt := env.Runtime()
+		rt.Programs = append(rt.Programs, object.LoadedProgram{File: filename, Source: programStr, Program: program})
+	}
 
 	return Eval(program, env)
 }
@@ -0,0 +1,155 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"koko/ast"
+	"koko/object"
+	"strings"
+)
+
+// htmlGraph is the data the HTML viewer is generated from: the dependency
+// graph, the function each value was computed in and the source of every
+// file a value was created in
+type htmlGraph struct {
+	Nodes    []htmlNode         `json:"nodes"`
+	Edges    []object.GraphEdge `json:"edges"`
+	Clusters []htmlCluster      `json:"clusters"`
+	Files    map[string]string  `json:"files"`
+}
+
+type htmlNode struct {
+	object.GraphNode
+	// EndLine is the last line of the expression which created the value
+	EndLine int `json:"end_line,omitempty"`
+	// Cluster is the function literal the value was created in, or -1
+	Cluster int `json:"cluster"`
+}
+
+type htmlCluster struct {
+	ID     int    `json:"id"`
+	Label  string `json:"label"`
+	Parent int    `json:"parent"`
+}
+
+// DependencyGraphHTML renders the dependency graph of result as a single
+// HTML page which needs nothing but a browser. Values can be clicked to
+// highlight what they depend on and what depends on them, and to show where
+// they were created in the source. Values created inside a function are
+// grouped together, and each group can be collapsed into a single node.
+//
+// Sources are those of the programs rt loaded from files, so values created
+// in the REPL are shown without their source.
+func DependencyGraphHTML(rt *object.Runtime, result object.Object) (string, error) {
+	graph, objects := object.GetDependencyGraphObjects(result)
+	data := htmlGraph{
+		Nodes:    make([]htmlNode, 0, len(graph.Nodes)),
+		Edges:    graph.Edges,
+		Clusters: []htmlCluster{},
+		Files:    make(map[string]string),
+	}
+
+	clusters := make(map[ast.Node]int)
+	indexed := make(map[string]bool)
+	for i, node := range graph.Nodes {
+		out := htmlNode{GraphNode: node, Cluster: -1}
+		if node.Span != nil {
+			if !indexed[node.Span.File] {
+				indexed[node.Span.File] = true
+				indexPrograms(rt, node.Span.File, &data, clusters)
+			}
+			creator := objects[i].GetCreatorNode()
+			out.EndLine = lastLine(creator)
+			if cluster, ok := clusters[creator]; ok {
+				out.Cluster = cluster
+			}
+		}
+		data.Nodes = append(data.Nodes, out)
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	// json.Marshal escapes <, > and &, so the data can't end the script early
+	return strings.Replace(graphHTMLTemplate, "/*GRAPH*/null", string(encoded), 1), nil
+}
+
+// indexPrograms adds the source of the programs rt loaded from filename to
+// data, registers their functions as clusters and records the cluster each
+// of their syntax nodes is in
+func indexPrograms(rt *object.Runtime, filename string, data *htmlGraph, clusters map[ast.Node]int) {
+	for _, loaded := range rt.Programs {
+		if loaded.File != filename {
+			continue
+		}
+		data.Files[filename] = loaded.Source
+
+		names := make(map[ast.Node]string)
+		var functions []ast.Node
+		ast.Walk(loaded.Program, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.LetStatement:
+				names[node.Value] = node.Name.Value
+			case *ast.ConstStatement:
+				names[node.Value] = node.Name.Value
+			case *ast.FunctionLiteral, *ast.PureFunctionLiteral:
+				functions = append(functions, node)
+			}
+			return true
+		})
+
+		// functions are visited outside in, so inner functions claim their
+		// nodes after the functions around them
+		for _, fn := range functions {
+			parent, ok := clusters[fn]
+			if !ok {
+				parent = -1
+			}
+			cluster := htmlCluster{
+				ID:     len(data.Clusters),
+				Label:  functionLabel(fn, names[fn]),
+				Parent: parent,
+			}
+			data.Clusters = append(data.Clusters, cluster)
+			ast.Walk(fn, func(node ast.Node) bool {
+				if node != fn {
+					clusters[node] = cluster.ID
+				}
+				return true
+			})
+		}
+	}
+}
+
+func lastLine(node ast.Node) int {
+	last := 0
+	ast.Walk(node, func(child ast.Node) bool {
+		if span := child.Span(); !span.Empty() && span.BeginLine > last {
+			last = span.BeginLine
+		}
+		return true
+	})
+	return last
+}
+
+func functionLabel(fn ast.Node, name string) string {
+	var params []*ast.Identifier
+	keyword := "fn"
+	switch fn := fn.(type) {
+	case *ast.FunctionLiteral:
+		params = fn.Parameters
+	case *ast.PureFunctionLiteral:
+		params = fn.Parameters
+		keyword = "pfn"
+	}
+	names := make([]string, 0, len(params))
+	for _, p := range params {
+		names = append(names, p.Value)
+	}
+	label := fmt.Sprintf("%s(%s)", keyword, strings.Join(names, ", "))
+	if name != "" {
+		label = name + " = " + label
+	}
+	return fmt.Sprintf("%s, line %d", label, fn.Span().BeginLine)
+}
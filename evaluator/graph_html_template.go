@@ -0,0 +1,373 @@
+package evaluator
+
+// graphHTMLTemplate is the dependency graph viewer. The graph data replaces
+// the /*GRAPH*/null placeholder. Everything the page needs is inline, so it
+// works offline and can be attached to a bug report as a single file.
+const graphHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Koko dependency graph</title>
+<style>
+  body { margin: 0; font-family: sans-serif; font-size: 13px; display: flex; height: 100vh; color: #222; }
+  #graph { flex: 1; overflow: hidden; background: #fafafa; cursor: grab; }
+  #graph svg { width: 100%; height: 100%; }
+  #side { width: 420px; display: flex; flex-direction: column; border-left: 1px solid #ccc; }
+  #side > div { padding: 8px; border-bottom: 1px solid #ccc; overflow: auto; }
+  #details { min-height: 90px; }
+  #clusters { max-height: 30%; }
+  #source { flex: 1; font-family: monospace; white-space: pre; padding: 0 !important; }
+  h3 { margin: 0 0 6px 0; font-size: 13px; }
+  .line { padding: 0 6px; }
+  .line .no { display: inline-block; width: 36px; color: #999; text-align: right; margin-right: 8px; }
+  .line.hl { background: #fff3b0; }
+  .line .start { background: #f4a300; color: #fff; }
+  .node rect { fill: #fff; stroke: #777; rx: 4; }
+  .node.cluster rect { fill: #e6eefc; stroke: #4a72c4; stroke-dasharray: 4 2; }
+  .node text { font-size: 11px; pointer-events: none; }
+  .node .kind { fill: #888; }
+  .node { cursor: pointer; }
+  .edge { stroke: #aaa; fill: none; marker-end: url(#arrow); }
+  .dim { opacity: 0.2; }
+  .node.selected rect { stroke: #d62728; stroke-width: 3; }
+  .node.ancestor rect { stroke: #2ca02c; stroke-width: 2; }
+  .node.descendant rect { stroke: #1f77b4; stroke-width: 2; }
+  .edge.ancestor { stroke: #2ca02c; }
+  .edge.descendant { stroke: #1f77b4; }
+  .legend span { margin-right: 10px; }
+  ul { margin: 0; padding-left: 16px; }
+  button { font-size: 11px; }
+</style>
+</head>
+<body>
+<div id="graph"></div>
+<div id="side">
+  <div id="details"><h3>Dependency graph</h3>Click a value to see where it came from.
+    <div class="legend"><span style="color:#1f77b4">&#9632; depends on</span><span style="color:#2ca02c">&#9632; used by</span></div></div>
+  <div id="clusters"></div>
+  <div id="source"></div>
+</div>
+<script>
+"use strict";
+var data = /*GRAPH*/null;
+var NODE_W = 150, NODE_H = 34, GAP_X = 24, GAP_Y = 46;
+var collapsed = {};
+var selected = null;
+var view = null;
+var help = document.getElementById("details").innerHTML;
+var drag = null;
+// the click ending a drag shouldn't clear the selection, so the drag is
+// forgotten only after the click has been handled
+window.addEventListener("mouseup", function () {
+  if (drag) { drag.down = false; }
+  setTimeout(function () { drag = null; }, 0);
+});
+
+function clusterChain(c) {
+  var chain = [];
+  while (c >= 0) { chain.unshift(c); c = data.clusters[c].parent; }
+  return chain;
+}
+
+function visibleKey(node) {
+  var chain = clusterChain(node.cluster);
+  for (var i = 0; i < chain.length; i++) {
+    if (collapsed[chain[i]]) { return "c" + chain[i]; }
+  }
+  return "n" + node.id;
+}
+
+function buildView() {
+  var nodes = {}, order = [], edges = [], seenEdges = {};
+  data.nodes.forEach(function (node) {
+    var key = visibleKey(node);
+    if (!nodes[key]) {
+      nodes[key] = { key: key, members: [], out: [], in: [] };
+      order.push(key);
+    }
+    nodes[key].members.push(node.id);
+  });
+  data.edges.forEach(function (edge) {
+    var a = visibleKey(data.nodes[edge.object]), b = visibleKey(data.nodes[edge.depends_on]);
+    if (a === b || seenEdges[a + ">" + b]) { return; }
+    seenEdges[a + ">" + b] = true;
+    edges.push({ from: a, to: b });
+    nodes[a].out.push(b);
+    nodes[b].in.push(a);
+  });
+
+  // layers by distance from the result
+  var root = order[0], depth = {}, queue = [root], maxDepth = 0;
+  depth[root] = 0;
+  while (queue.length) {
+    var key = queue.shift();
+    nodes[key].out.forEach(function (next) {
+      if (depth[next] === undefined) {
+        depth[next] = depth[key] + 1;
+        maxDepth = Math.max(maxDepth, depth[next]);
+        queue.push(next);
+      }
+    });
+  }
+  var layers = [];
+  order.forEach(function (key) {
+    if (depth[key] === undefined) { depth[key] = maxDepth + 1; }
+    (layers[depth[key]] = layers[depth[key]] || []).push(key);
+  });
+
+  // order each layer by the average position of the values using it
+  var index = {};
+  layers.forEach(function (layer) {
+    if (!layer) { return; }
+    layer.forEach(function (key, i) {
+      var parents = nodes[key].in.filter(function (p) { return index[p] !== undefined; });
+      var sum = parents.reduce(function (s, p) { return s + index[p]; }, 0);
+      nodes[key].weight = parents.length ? sum / parents.length : i;
+    });
+    layer.sort(function (a, b) { return nodes[a].weight - nodes[b].weight; });
+    layer.forEach(function (key, i) { index[key] = i - (layer.length - 1) / 2; });
+  });
+  Object.keys(nodes).forEach(function (key) {
+    nodes[key].x = index[key] * (NODE_W + GAP_X);
+    nodes[key].y = depth[key] * (NODE_H + GAP_Y);
+  });
+  return { nodes: nodes, edges: edges, order: order };
+}
+
+function svgEl(name, attrs) {
+  var el = document.createElementNS("http://www.w3.org/2000/svg", name);
+  Object.keys(attrs || {}).forEach(function (k) { el.setAttribute(k, attrs[k]); });
+  return el;
+}
+
+function shorten(text, n) {
+  return text.length > n ? text.slice(0, n - 1) + "…" : text;
+}
+
+function labelFor(vnode) {
+  if (vnode.key[0] === "c") {
+    var cluster = data.clusters[+vnode.key.slice(1)];
+    return [shorten(cluster.label, 24), vnode.members.length + " values"];
+  }
+  var node = data.nodes[vnode.members[0]];
+  return [shorten(node.value, 24), shorten(node.creator || node.type, 24)];
+}
+
+var viewBox = null;
+
+function render() {
+  view = buildView();
+  var container = document.getElementById("graph");
+  container.innerHTML = "";
+  var svg = svgEl("svg");
+  var defs = svgEl("defs");
+  var marker = svgEl("marker", { id: "arrow", viewBox: "0 0 10 10", refX: 10, refY: 5, markerWidth: 6, markerHeight: 6, orient: "auto" });
+  marker.appendChild(svgEl("path", { d: "M 0 0 L 10 5 L 0 10 z", fill: "#999" }));
+  defs.appendChild(marker);
+  svg.appendChild(defs);
+
+  var minX = Infinity, maxX = -Infinity, maxY = 0;
+  view.edges.forEach(function (edge) {
+    var a = view.nodes[edge.from], b = view.nodes[edge.to];
+    var path = svgEl("path", {
+      d: "M " + a.x + " " + (a.y + NODE_H / 2) + " C " + a.x + " " + (a.y + NODE_H / 2 + GAP_Y / 2) + " " +
+        b.x + " " + (b.y - NODE_H / 2 - GAP_Y / 2) + " " + b.x + " " + (b.y - NODE_H / 2),
+      "class": "edge"
+    });
+    edge.el = path;
+    svg.appendChild(path);
+  });
+  view.order.forEach(function (key) {
+    var vnode = view.nodes[key];
+    minX = Math.min(minX, vnode.x); maxX = Math.max(maxX, vnode.x); maxY = Math.max(maxY, vnode.y);
+    var g = svgEl("g", { "class": "node" + (key[0] === "c" ? " cluster" : ""), transform: "translate(" + vnode.x + "," + vnode.y + ")" });
+    g.appendChild(svgEl("rect", { x: -NODE_W / 2, y: -NODE_H / 2, width: NODE_W, height: NODE_H }));
+    var lines = labelFor(vnode);
+    var value = svgEl("text", { x: 0, y: -3, "text-anchor": "middle" });
+    value.textContent = lines[0];
+    var kind = svgEl("text", { x: 0, y: 11, "text-anchor": "middle", "class": "kind" });
+    kind.textContent = lines[1];
+    g.appendChild(value);
+    g.appendChild(kind);
+    g.addEventListener("click", function (e) { e.stopPropagation(); select(key); });
+    vnode.el = g;
+    svg.appendChild(g);
+  });
+  if (!viewBox) {
+    viewBox = { x: minX - NODE_W, y: -NODE_H * 2, w: Math.max(maxX - minX + NODE_W * 2, 600), h: Math.max(maxY + NODE_H * 4, 400) };
+  }
+  svg.setAttribute("viewBox", [viewBox.x, viewBox.y, viewBox.w, viewBox.h].join(" "));
+  svg.setAttribute("preserveAspectRatio", "xMidYMin meet");
+  container.appendChild(svg);
+  enablePanZoom(svg);
+  svg.addEventListener("click", function () { if (!drag || !drag.moved) { select(null); } });
+
+  if (selected && !view.nodes[selected]) { selected = null; }
+  select(selected);
+}
+
+function reach(start, next) {
+  var seen = {}, stack = [start];
+  while (stack.length) {
+    var key = stack.pop();
+    view.nodes[key][next].forEach(function (k) {
+      if (!seen[k]) { seen[k] = true; stack.push(k); }
+    });
+  }
+  return seen;
+}
+
+function select(key) {
+  selected = key;
+  var descendants = key ? reach(key, "out") : {}, ancestors = key ? reach(key, "in") : {};
+  view.order.forEach(function (k) {
+    var el = view.nodes[k].el;
+    el.classList.toggle("selected", k === key);
+    el.classList.toggle("descendant", !!descendants[k] && k !== key);
+    el.classList.toggle("ancestor", !!ancestors[k] && k !== key);
+    el.classList.toggle("dim", !!key && k !== key && !descendants[k] && !ancestors[k]);
+  });
+  view.edges.forEach(function (edge) {
+    var down = key && (edge.from === key || descendants[edge.from]) && descendants[edge.to];
+    var up = key && (edge.to === key || ancestors[edge.to]) && ancestors[edge.from];
+    edge.el.classList.toggle("descendant", !!down);
+    edge.el.classList.toggle("ancestor", !!up && !down);
+    edge.el.classList.toggle("dim", !!key && !down && !up);
+  });
+  showDetails(key);
+}
+
+function text(tag, content) {
+  var el = document.createElement(tag);
+  el.textContent = content;
+  return el;
+}
+
+function showDetails(key) {
+  var details = document.getElementById("details");
+  details.innerHTML = key ? "" : help;
+  if (!key) { showSource(null); return; }
+  var vnode = view.nodes[key];
+  if (key[0] === "c") {
+    var id = +key.slice(1);
+    details.appendChild(text("h3", data.clusters[id].label));
+    details.appendChild(text("div", vnode.members.length + " values computed in this function"));
+    var expand = text("button", "expand");
+    expand.addEventListener("click", function () { toggleCluster(id, false); });
+    details.appendChild(expand);
+    showSource(null);
+    return;
+  }
+  var node = data.nodes[vnode.members[0]];
+  details.appendChild(text("h3", node.value));
+  details.appendChild(text("div", "type: " + node.type));
+  if (node.creator) { details.appendChild(text("div", "created by " + node.creator + ": " + node.source)); }
+  if (node.span) { details.appendChild(text("div", "at " + (node.span.file || "?") + " line " + node.span.line + ", pos " + node.span.pos)); }
+  if (node.cluster >= 0) { details.appendChild(text("div", "in " + data.clusters[node.cluster].label)); }
+  details.appendChild(text("div", "depends on " + vnode.out.length + ", used by " + vnode.in.length));
+  showSource(node);
+}
+
+function showSource(node) {
+  var pane = document.getElementById("source");
+  pane.innerHTML = "";
+  if (!node || !node.span || data.files[node.span.file] === undefined) { return; }
+  var lines = data.files[node.span.file].split("\n");
+  var end = Math.max(node.end_line || node.span.line, node.span.line);
+  var first = null;
+  lines.forEach(function (line, i) {
+    var no = i + 1;
+    var row = document.createElement("div");
+    row.className = "line" + (no >= node.span.line && no <= end ? " hl" : "");
+    row.appendChild(text("span", String(no))).className = "no";
+    if (no === node.span.line) {
+      // the first line counts positions from 0, later lines from 1, and
+      // positions count characters, so the line is split into code points
+      var start = no === 1 ? node.span.pos : node.span.pos - 1;
+      var chars = Array.from(line);
+      row.appendChild(document.createTextNode(chars.slice(0, start).join("")));
+      row.appendChild(text("span", chars.slice(start, start + 1).join("") || " ")).className = "start";
+      row.appendChild(document.createTextNode(chars.slice(start + 1).join("")));
+      first = row;
+    } else {
+      row.appendChild(document.createTextNode(line));
+    }
+    pane.appendChild(row);
+  });
+  if (first) { first.scrollIntoView({ block: "center" }); }
+}
+
+function toggleCluster(id, value) {
+  collapsed[id] = value;
+  renderClusters();
+  render();
+}
+
+function renderClusters() {
+  var pane = document.getElementById("clusters");
+  pane.innerHTML = "";
+  if (!data.clusters.length) { return; }
+  pane.appendChild(text("h3", "Functions"));
+  var all = text("button", "collapse all");
+  all.addEventListener("click", function () {
+    data.clusters.forEach(function (c) { collapsed[c.id] = true; });
+    renderClusters(); render();
+  });
+  var none = text("button", "expand all");
+  none.addEventListener("click", function () { collapsed = {}; renderClusters(); render(); });
+  pane.appendChild(all);
+  pane.appendChild(none);
+  var used = {};
+  data.nodes.forEach(function (n) { clusterChain(n.cluster).forEach(function (c) { used[c] = true; }); });
+  function list(parent) {
+    var ul = document.createElement("ul");
+    data.clusters.forEach(function (c) {
+      if (c.parent !== parent || !used[c.id]) { return; }
+      var li = document.createElement("li");
+      var label = document.createElement("label");
+      var box = document.createElement("input");
+      box.type = "checkbox";
+      box.checked = !!collapsed[c.id];
+      box.addEventListener("change", function () { toggleCluster(c.id, box.checked); });
+      label.appendChild(box);
+      label.appendChild(document.createTextNode(" " + c.label));
+      li.appendChild(label);
+      var children = list(c.id);
+      if (children.childNodes.length) { li.appendChild(children); }
+      ul.appendChild(li);
+    });
+    return ul;
+  }
+  pane.appendChild(list(-1));
+}
+
+function enablePanZoom(svg) {
+  function apply() { svg.setAttribute("viewBox", [viewBox.x, viewBox.y, viewBox.w, viewBox.h].join(" ")); }
+  svg.addEventListener("wheel", function (e) {
+    e.preventDefault();
+    var scale = e.deltaY > 0 ? 1.1 : 1 / 1.1;
+    var rect = svg.getBoundingClientRect();
+    var fx = (e.clientX - rect.left) / rect.width, fy = (e.clientY - rect.top) / rect.height;
+    viewBox.x += viewBox.w * fx * (1 - scale);
+    viewBox.y += viewBox.h * fy * (1 - scale);
+    viewBox.w *= scale;
+    viewBox.h *= scale;
+    apply();
+  });
+  svg.addEventListener("mousedown", function (e) { drag = { x: e.clientX, y: e.clientY, moved: false, down: true }; });
+  svg.addEventListener("mousemove", function (e) {
+    if (!drag || !drag.down) { return; }
+    var rect = svg.getBoundingClientRect();
+    viewBox.x -= (e.clientX - drag.x) * viewBox.w / rect.width;
+    viewBox.y -= (e.clientY - drag.y) * viewBox.h / rect.height;
+    drag = { x: e.clientX, y: e.clientY, moved: true, down: true };
+    apply();
+  });
+}
+
+renderClusters();
+render();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,239 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"koko/ast"
+	"koko/lexer"
+	"koko/object"
+	"koko/parser"
+	"sort"
+	"strings"
+)
+
+// A DynamicLinter runs programs, typically the tests of a library, and finds
+// the parameters of functions, and the array elements and hash values passed
+// in them, which never influenced the result of any call. This is what the
+// `deps` builtin reports for a single call, aggregated over every call.
+//
+// Calls are grouped by the function literal which was called, so the
+// results of several programs importing the same file add up.
+type DynamicLinter struct {
+	functions map[string]*functionUsage
+}
+
+type functionUsage struct {
+	name   string
+	params []*ast.Identifier
+	calls  int
+	fields map[string]*fieldUsage
+}
+
+// fieldUsage counts the calls which passed a parameter or part of one, and
+// the calls whose result depended on it
+type fieldUsage struct {
+	path object.DependencyPath
+	seen int
+	used int
+}
+
+// LintFinding is an input which never influenced a function's result
+type LintFinding struct {
+	Span    ast.Span
+	Message string
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s line %d, pos %d: %s", f.Span.File, f.Span.BeginLine, f.Span.BeginPos, f.Message)
+}
+
+func NewDynamicLinter() *DynamicLinter {
+	return &DynamicLinter{functions: make(map[string]*functionUsage)}
+}
+
+// Run evaluates a program in a new environment, which traces dependencies,
+// recording the calls it makes
+func (l *DynamicLinter) Run(programStr string, filename string) error {
+	p := parser.New(lexer.New(programStr, filename))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	env := object.NewEnvironment()
+	env.Runtime().CallObserver = l.record
+	res := Eval(program, env)
+	if isError(res) {
+		return errors.New(res.Inspect())
+	}
+	return nil
+}
+
+func (l *DynamicLinter) record(call *ast.CallExpression, fn object.Object, args []object.Object, res object.Object) {
+	var params []*ast.Identifier
+	var body *ast.BlockStatement
+	switch fn := fn.(type) {
+	case *object.Function:
+		params, body = fn.Parameters, fn.Body
+	case *object.PureFunction:
+		params, body = fn.Parameters, fn.Body
+	default:
+		return
+	}
+	if len(params) == 0 || len(args) != len(params) {
+		return
+	}
+
+	span := body.Span()
+	key := fmt.Sprintf("%s:%d:%d", span.File, span.BeginLine, span.BeginPos)
+	usage, ok := l.functions[key]
+	if !ok {
+		usage = &functionUsage{params: params, fields: make(map[string]*fieldUsage)}
+		l.functions[key] = usage
+	}
+	if ident, ok := call.Function.(*ast.Identifier); ok && usage.name == "" {
+		usage.name = ident.Value
+	}
+	usage.calls++
+
+	used := object.CollectDependencyPaths(args, object.GetAllDependencies(res))
+	for i, arg := range args {
+		usage.visit(arg, i, nil, used)
+	}
+}
+
+// visit counts a call for the part of an argument at steps and everything
+// inside it
+func (u *functionUsage) visit(obj object.Object, arg int, steps []object.PathStep, used []object.DependencyPath) {
+	path := object.DependencyPath{Arg: arg, Steps: append([]object.PathStep{}, steps...)}
+	field, ok := u.fields[path.Encode()]
+	if !ok {
+		field = &fieldUsage{path: path}
+		u.fields[path.Encode()] = field
+	}
+	field.seen++
+	if influenced(arg, steps, used) {
+		field.used++
+	}
+
+	switch container := obj.(type) {
+	case *object.Array:
+		for i, el := range container.Elements {
+			u.visit(el, arg, append(steps, object.PathStep{Index: int64(i)}), used)
+		}
+	case *object.Hash:
+		for _, pair := range container.Pairs {
+			u.visit(pair.Value, arg, append(steps, object.PathStep{Key: pair.Key}), used)
+		}
+	}
+}
+
+// influenced reports whether the part of an argument at steps influenced a
+// result: when something inside it was used, or when all of something
+// around it was
+func influenced(arg int, steps []object.PathStep, used []object.DependencyPath) bool {
+	for _, path := range used {
+		if path.Arg != arg {
+			continue
+		}
+		if hasPrefix(path.Steps, steps) || (!path.Length && hasPrefix(steps, path.Steps)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(steps []object.PathStep, prefix []object.PathStep) bool {
+	if len(prefix) > len(steps) {
+		return false
+	}
+	for i := range prefix {
+		if steps[i].Encode() != prefix[i].Encode() {
+			return false
+		}
+	}
+	return true
+}
+
+// Findings lists the inputs which never influenced a result, ordered by
+// position. Parts of an input are only listed when the rest of it was used.
+func (l *DynamicLinter) Findings() []LintFinding {
+	findings := []LintFinding{}
+	for _, usage := range l.functions {
+		fields := make([]*fieldUsage, 0, len(usage.fields))
+		for _, field := range usage.fields {
+			fields = append(fields, field)
+		}
+		// parents sort before the parts inside them
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].path.Encode() < fields[j].path.Encode()
+		})
+
+		reported := []*fieldUsage{}
+		for _, field := range fields {
+			if field.used > 0 || insideAny(field, reported) {
+				continue
+			}
+			reported = append(reported, field)
+			findings = append(findings, usage.finding(field))
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i].Span, findings[j].Span
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.BeginLine != b.BeginLine {
+			return a.BeginLine < b.BeginLine
+		}
+		if a.BeginPos != b.BeginPos {
+			return a.BeginPos < b.BeginPos
+		}
+		return findings[i].Message < findings[j].Message
+	})
+	return findings
+}
+
+func insideAny(field *fieldUsage, fields []*fieldUsage) bool {
+	for _, other := range fields {
+		if other.path.Arg == field.path.Arg && hasPrefix(field.path.Steps, other.path.Steps) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *functionUsage) finding(field *fieldUsage) LintFinding {
+	param := u.params[field.path.Arg]
+	name := "function"
+	if u.name != "" {
+		name = "`" + u.name + "`"
+	}
+	calls := "1 call"
+	if u.calls != 1 {
+		calls = fmt.Sprintf("%d calls", u.calls)
+	}
+	if len(field.path.Steps) == 0 {
+		return LintFinding{
+			Span:    param.Span(),
+			Message: fmt.Sprintf("parameter `%s` of %s never influenced its result in %s", param.Value, name, calls),
+		}
+	}
+
+	var path strings.Builder
+	path.WriteString(param.Value)
+	for _, step := range field.path.Steps {
+		if step.Key == nil {
+			fmt.Fprintf(&path, "[%d]", step.Index)
+		} else if str, ok := step.Key.(*object.String); ok {
+			fmt.Fprintf(&path, "[%q]", str.Value)
+		} else {
+			fmt.Fprintf(&path, "[%s]", step.Key.Inspect())
+		}
+	}
+	return LintFinding{
+		Span: param.Span(),
+		Message: fmt.Sprintf("`%s` of %s never influenced its result in %d of %s", path.String(), name,
+			field.seen, calls),
+	}
+}
@@ -0,0 +1,179 @@
+package evaluator
+
+import (
+	"koko/ast"
+	"koko/object"
+	"sort"
+)
+
+// enterLoop pushes a frame for a loop being evaluated onto the runtime's
+// loops. Values bound by let statements in a loop body depend on the controls
+// of the loops, the way the value of an if depends on its condition.
+func enterLoop(rt *object.Runtime) {
+	rt.Loops = append(rt.Loops, object.LoopFrame{})
+}
+
+func exitLoop(rt *object.Runtime) {
+	rt.Loops = rt.Loops[:len(rt.Loops)-1]
+}
+
+// A loop statement evaluates to nil, depending on every value which
+// decided how many times its body ran
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	rt := env.Runtime()
+	enterLoop(rt)
+	defer exitLoop(rt)
+	res := rt.Copy(object.NIL)
+	for {
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		rt.AddDependency(res, condition)
+		if !object.Bool(condition) {
+			return res
+		}
+
+		signal := evalLoopBody(node.Body, env, condition)
+		if stop := handleLoopSignal(rt, signal, res); stop != nil {
+			return stop
+		}
+	}
+}
+
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	rt := env.Runtime()
+	iterable := Eval(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	items, control, ok := loopItems(rt, iterable)
+	if !ok {
+		return newError("%s: can't loop over %s", node.Token.Context, iterable.Type())
+	}
+
+	enterLoop(rt)
+	defer exitLoop(rt)
+	res := rt.Copy(object.NIL)
+	rt.AddDependency(res, control)
+	for _, item := range items {
+		if bound := env.Set(node.Variable.Value, item); isError(bound) {
+			return bound
+		}
+		signal := evalLoopBody(node.Body, env, control)
+		if stop := handleLoopSignal(rt, signal, res); stop != nil {
+			return stop
+		}
+	}
+	return res
+}
+
+// loopItems returns what a for loop binds its variable to: the elements of
+// an array, the keys of a hash, the dependency paths of a trace or the
+// characters of a string. The number of items depends on control.
+func loopItems(rt *object.Runtime, iterable object.Object) ([]object.Object, object.Object, bool) {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		return iterable.Elements, &iterable.Length, true
+	case *object.Hash:
+		keys := make([]object.Object, 0, len(iterable.Pairs))
+		for _, pair := range iterable.Pairs {
+			// which keys there are depends on the hash's keys
+			key := rt.Copy(pair.Key)
+			rt.AddDependency(key, &iterable.Length)
+			keys = append(keys, key)
+		}
+		// hashes are unordered, but loops over them shouldn't be
+		sort.Slice(keys, func(i, j int) bool { return object.Encode(keys[i]) < object.Encode(keys[j]) })
+		return keys, &iterable.Length, true
+	case *object.Trace:
+		paths := iterable.DepsArray()
+		return paths.Elements, &paths.Length, true
+	case *object.String:
+		chars := []object.Object{}
+		for _, char := range iterable.Value {
+			el := &object.String{Value: string(char)}
+			rt.AddDependency(el, iterable)
+			chars = append(chars, el)
+		}
+		return chars, iterable, true
+	}
+	return nil, nil, false
+}
+
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment, control object.Object) object.Object {
+	loops := env.Runtime().Loops
+	loops[len(loops)-1].Control = control
+	return evalBlockStatement(body, env)
+}
+
+// handleLoopSignal returns what the loop evaluates to when signal ends it:
+// itself for a break, or the return value or error to pass on. The values
+// last bound in the loop when it broke out are the last ones because of the
+// break, so they come to depend on it. They were made for the binding, so
+// the dependency is added to them as they are, rather than by binding them
+// again.
+func handleLoopSignal(rt *object.Runtime, signal object.Object, res object.Object) object.Object {
+	switch signal := signal.(type) {
+	case *object.Break:
+		rt.AddDependency(res, signal)
+		for _, val := range rt.Loops[len(rt.Loops)-1].Bound {
+			rt.AddDependency(val, signal)
+		}
+		return res
+	case *object.Return, *object.Error:
+		return signal
+	}
+	return nil
+}
+
+// withControlDependencies makes a value bound inside loop bodies depend on
+// what decided that they ran
+func withControlDependencies(rt *object.Runtime, val object.Object) object.Object {
+	if len(rt.Loops) == 0 || !rt.Tracing() {
+		return val
+	}
+	res := val.Copy()
+	for _, frame := range rt.Loops {
+		res.AddDependency(frame.Control)
+	}
+	return res
+}
+
+// noteLoopBinding records val as the last value bound to name in the loops
+// being evaluated, which it depends on if they break
+func noteLoopBinding(rt *object.Runtime, name string, val object.Object) {
+	if !rt.Tracing() {
+		return
+	}
+	for i := range rt.Loops {
+		if rt.Loops[i].Bound == nil {
+			rt.Loops[i].Bound = make(map[string]object.Object)
+		}
+		rt.Loops[i].Bound[name] = val
+	}
+}
+
+// loopSignalError turns a break or continue which escaped every loop, e.g.
+// out of a function body, into an error
+func loopSignalError(obj object.Object) object.Object {
+	switch obj.(type) {
+	case *object.Break:
+		return newError("break outside of a loop")
+	case *object.Continue:
+		return newError("continue outside of a loop")
+	}
+	return obj
+}
+
+// evalFunctionBody evaluates the body of a called function. Loops around the
+// call decide whether it is made, not what it computes, so their control
+// dependencies don't apply inside it.
+func evalFunctionBody(body *ast.BlockStatement, env *object.Environment) object.Object {
+	rt := env.Runtime()
+	outer := rt.Loops
+	rt.Loops = nil
+	defer func() { rt.Loops = outer }()
+	// the result keeps the expression which computed it as its creator
+	return unwrapReturnValue(rt, evalBlockStatement(body, env))
+}
@@ -0,0 +1,167 @@
+package evaluator
+
+import (
+	"fmt"
+	"koko/ast"
+	"koko/object"
+	"sort"
+	"strings"
+)
+
+// validatePureFunctionCache makes sure the cached results of fn were
+// computed with the values fn captures now, which change when a captured name
+// is bound again or assigned to. Otherwise the results are dropped, and with
+// a cache directory the ones saved for the new values are loaded instead. The
+// cache is best effort, so a directory which can't be used just leaves the
+// cache in memory.
+//
+// This runs before every call, so the values are compared as they are looked
+// up, using the free names found when the function was created. The
+// fingerprint is only computed again when they differ.
+func validatePureFunctionCache(fn *object.PureFunction) {
+	previous, ok := fn.Cache.Captured()
+	i := 0
+	same := ok && walkCapturedValues(fn.FreeNames, fn.Body, fn.Env, nil, func(val object.Object) bool {
+		if i >= len(previous) || previous[i] != val {
+			return false
+		}
+		i++
+		return true
+	})
+	if same && i == len(previous) {
+		return
+	}
+
+	captured := []object.Object{}
+	walkCapturedValues(fn.FreeNames, fn.Body, fn.Env, nil, func(val object.Object) bool {
+		captured = append(captured, val)
+		return true
+	})
+	fingerprint := pureFunctionFingerprint(fn)
+	if dir := fn.Env.Runtime().CacheDir; fn.Cache.Recapture(captured, fingerprint) && dir != "" {
+		fn.Cache.Persist(dir, fingerprint)
+	}
+}
+
+// closure identifies a function by its body and the scope it captures
+type closure struct {
+	body *ast.BlockStatement
+	env  *object.Environment
+}
+
+// walkCapturedValues visits the values of the free variables of a function
+// and, in turn, of the functions among them, in a fixed order, until visit
+// returns false. Names which aren't bound are visited as nil. It reports
+// whether every value was visited.
+func walkCapturedValues(
+	names []string,
+	body *ast.BlockStatement,
+	env *object.Environment,
+	visited map[closure]bool,
+	visit func(object.Object) bool,
+) bool {
+	for _, name := range names {
+		val, _ := env.Get(name)
+		if !visit(val) {
+			return false
+		}
+		var captured closure
+		var capturedNames []string
+		switch val := val.(type) {
+		case *object.Function:
+			if val.FreeNames == nil {
+				val.FreeNames = freeNames(val.Parameters, val.Body)
+			}
+			captured, capturedNames = closure{val.Body, val.Env}, val.FreeNames
+		case *object.PureFunction:
+			captured, capturedNames = closure{val.Body, val.Env}, val.FreeNames
+		default:
+			continue
+		}
+		if visited == nil {
+			// most functions don't capture others, so this is only made
+			// when one does
+			visited = map[closure]bool{{body, env}: true}
+		}
+		if visited[captured] {
+			continue
+		}
+		visited[captured] = true
+		if !walkCapturedValues(capturedNames, captured.body, captured.env, visited, visit) {
+			return false
+		}
+	}
+	return true
+}
+
+// pureFunctionFingerprint identifies a pure function across runs by its
+// parameters, its body and the values of the free variables it captures.
+// Captured functions are fingerprinted the same way, so editing a helper
+// invalidates the results of every pure function calling it.
+func pureFunctionFingerprint(fn *object.PureFunction) string {
+	var out strings.Builder
+	writeFunctionFingerprint(&out, fn.Parameters, fn.Body, fn.Env, make(map[closure]bool))
+	return out.String()
+}
+
+func writeFunctionFingerprint(
+	out *strings.Builder,
+	params []*ast.Identifier,
+	body *ast.BlockStatement,
+	env *object.Environment,
+	visited map[closure]bool,
+) {
+	if visited[closure{body, env}] {
+		// recursive references are already covered by the outer fingerprint
+		out.WriteString("<recursive>")
+		return
+	}
+	visited[closure{body, env}] = true
+
+	paramNames := []string{}
+	for _, p := range params {
+		paramNames = append(paramNames, p.Value)
+	}
+	fmt.Fprintf(out, "fn(%s) {%s}", strings.Join(paramNames, ", "), body.String())
+
+	for _, name := range freeNames(params, body) {
+		fmt.Fprintf(out, "[%s=", name)
+		val, ok := env.Get(name)
+		if !ok {
+			if _, ok := builtins[name]; ok {
+				out.WriteString("builtin")
+			} else {
+				out.WriteString("?")
+			}
+			out.WriteString("]")
+			continue
+		}
+		switch val := val.(type) {
+		case *object.Function:
+			writeFunctionFingerprint(out, val.Parameters, val.Body, val.Env, visited)
+		case *object.PureFunction:
+			writeFunctionFingerprint(out, val.Parameters, val.Body, val.Env, visited)
+		case *object.Builtin:
+			out.WriteString("builtin")
+		default:
+			out.WriteString(object.Encode(val))
+		}
+		out.WriteString("]")
+	}
+}
+
+// freeNames lists the identifiers a function body uses without binding them,
+// in sorted order
+func freeNames(params []*ast.Identifier, body *ast.BlockStatement) []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	walkFreeNames(params, body, func(ident *ast.Identifier, assigned bool) bool {
+		if !seen[ident.Value] {
+			seen[ident.Value] = true
+			names = append(names, ident.Value)
+		}
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,195 @@
+package evaluator
+
+import (
+	"koko/ast"
+	"koko/object"
+)
+
+// checkPurity makes sure the body of a pure function cannot reach a side
+// effecting builtin or a closure which does, doesn't assign to names it
+// doesn't bind itself and doesn't import files. Memoized results of such a
+// function would silently be wrong.
+//
+// Identifiers are resolved through the scopes of the function and the
+// functions nested in it, then through the enclosing scope and the builtins
+// table, the same way evalIdentifier resolves them. Identifiers which are not
+// bound yet (e.g. a pure function referring to itself) can't be checked, so
+// resolved is false when there are any, and the check has to be made again
+// once they are bound.
+func checkPurity(params []*ast.Identifier, body *ast.BlockStatement, env *object.Environment) (bool, object.Object) {
+	check := &purityCheck{visited: make(map[*ast.BlockStatement]bool)}
+	err := checkBodyPurity(params, body, env, check)
+	return !check.unresolved, err
+}
+
+type purityCheck struct {
+	visited    map[*ast.BlockStatement]bool
+	unresolved bool
+}
+
+func checkBodyPurity(
+	params []*ast.Identifier,
+	body *ast.BlockStatement,
+	env *object.Environment,
+	check *purityCheck,
+) object.Object {
+	if check.visited[body] {
+		return nil
+	}
+	check.visited[body] = true
+
+	var err object.Object
+	ast.Walk(body, func(node ast.Node) bool {
+		if imp, ok := node.(*ast.ImportStatement); ok && err == nil {
+			// importing evaluates a file, which can do anything
+			err = newError("%s: pure function can't import `%s`", imp.Token.Context, imp.Value)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	walkFreeNames(params, body, func(ident *ast.Identifier, assigned bool) bool {
+		if assigned {
+			err = newError("%s: pure function can't assign to `%s`", ident.Token.Context, ident.Value)
+		} else {
+			err = checkIdentifierPurity(ident, env, check)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func checkIdentifierPurity(
+	ident *ast.Identifier,
+	env *object.Environment,
+	check *purityCheck,
+) object.Object {
+	val, ok := env.Get(ident.Value)
+	if !ok {
+		if scoped, ok := scopedBuiltins[ident.Value]; ok {
+			val = scoped(env)
+		} else if builtin, ok := builtins[ident.Value]; ok {
+			val = builtin
+		} else {
+			check.unresolved = true
+			return nil
+		}
+	}
+
+	switch val := val.(type) {
+	case *object.Builtin:
+		if !val.Pure {
+			return newError("%s: pure function can't call impure builtin `%s`",
+				ident.Token.Context, ident.Value)
+		}
+	case *object.Function:
+		if inner := checkBodyPurity(val.Parameters, val.Body, val.Env, check); inner != nil {
+			return newError("%s: pure function can't call impure function `%s`, %s",
+				ident.Token.Context, ident.Value, inner.(*object.Error).Message)
+		}
+	}
+	return nil
+}
+
+// checkCallPurity makes sure a call made while the body of a pure function is
+// evaluated only reaches pure code. checkPurity only sees the functions a body
+// names, so functions passed as arguments or read out of arrays and hashes
+// are checked when they are called.
+func checkCallPurity(rt *object.Runtime, call *ast.CallExpression, fn object.Object) object.Object {
+	if rt.PureCalls == 0 {
+		return nil
+	}
+	switch fn := fn.(type) {
+	case *object.Builtin:
+		if !fn.Pure {
+			return newError("%s: pure function can't call impure builtin `%s`",
+				call.Token.Context, call.Function.String())
+		}
+	case *object.Function:
+		if fn.Checked {
+			return nil
+		}
+		if _, err := checkPurity(fn.Parameters, fn.Body, fn.Env); err != nil {
+			return newError("%s: pure function can't call impure function `%s`, %s",
+				call.Token.Context, call.Function.String(), err.(*object.Error).Message)
+		}
+	}
+	return nil
+}
+
+// walkFreeNames calls visit for every identifier in a function body which
+// neither the function nor a function nested in it around the identifier
+// binds, and for the names such identifiers assign to, until visit returns
+// false
+func walkFreeNames(params []*ast.Identifier, body *ast.BlockStatement, visit func(ident *ast.Identifier, assigned bool) bool) {
+	walkScopeFreeNames(params, body, nil, visit)
+}
+
+func walkScopeFreeNames(
+	params []*ast.Identifier,
+	body *ast.BlockStatement,
+	outer []map[string]bool,
+	visit func(ident *ast.Identifier, assigned bool) bool,
+) bool {
+	scopes := append(append([]map[string]bool{}, outer...), localNames(params, body))
+	bound := func(name string) bool {
+		for _, scope := range scopes {
+			if scope[name] {
+				return true
+			}
+		}
+		return false
+	}
+
+	more := true
+	ast.Walk(body, func(node ast.Node) bool {
+		if !more {
+			return false
+		}
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			more = walkScopeFreeNames(node.Parameters, node.Body, scopes, visit)
+			return false
+		case *ast.PureFunctionLiteral:
+			more = walkScopeFreeNames(node.Parameters, node.Body, scopes, visit)
+			return false
+		case *ast.AssignExpression:
+			if root, _ := assignmentTarget(node.Target); !bound(root.Value) {
+				more = visit(root, true)
+			}
+		case *ast.Identifier:
+			if !bound(node.Value) {
+				more = visit(node, false)
+			}
+		}
+		return more
+	})
+	return more
+}
+
+// localNames collects every name a function binds in its own scope: its
+// parameters, its let and const statements and loop variables. Names bound
+// by the functions nested in it are local to those.
+func localNames(params []*ast.Identifier, body *ast.BlockStatement) map[string]bool {
+	locals := make(map[string]bool)
+	for _, p := range params {
+		locals[p.Value] = true
+	}
+	ast.Walk(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			locals[node.Name.Value] = true
+		case *ast.CellStatement:
+			locals[node.Name.Value] = true
+		case *ast.ConstStatement:
+			locals[node.Name.Value] = true
+		case *ast.ForStatement:
+			locals[node.Variable.Value] = true
+		case *ast.FunctionLiteral, *ast.PureFunctionLiteral:
+			return false
+		}
+		return true
+	})
+	return locals
+}
@@ -0,0 +1,293 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"koko/ast"
+	"koko/lexer"
+	"koko/object"
+	"koko/parser"
+	"strings"
+)
+
+// A Session keeps a program evaluated as its source is edited. Each Update
+// only re-evaluates the top level statements which changed, and those which
+// refer to a name bound by a re-evaluated statement, directly or inside a
+// function body. Everything else keeps the value it had.
+//
+// The session falls back to evaluating the whole program again when the
+// program binds a name more than once at the top level, has a loop at the
+// top level, assigns to a name anywhere or an import is added or removed,
+// since then which binding a statement sees depends on more than the names
+// it refers to.
+type Session struct {
+	filename   string
+	env        *object.Environment
+	statements []*sessionStatement
+}
+
+type sessionStatement struct {
+	node      ast.Statement
+	source    string
+	binds     string
+	reads     map[string]bool
+	value     object.Object
+	evaluated bool
+}
+
+// UpdateResult describes what an update of a session did
+type UpdateResult struct {
+	// Result is the value of the program, like LoadProgram returns
+	Result object.Object
+	// Changed lists the top level let bindings which were added, removed or
+	// re-evaluated, in program order
+	Changed []string
+	// Evaluated counts the top level statements which were evaluated
+	Evaluated int
+}
+
+func NewSession(filename string) *Session {
+	return &Session{filename: filename, env: object.NewEnvironment()}
+}
+
+// Env returns the environment holding the session's top level bindings
+func (s *Session) Env() *object.Environment { return s.env }
+
+// Update evaluates the new source of the program. The session is left as it
+// was when the source doesn't parse.
+func (s *Session) Update(source string) (*UpdateResult, error) {
+	p := parser.New(lexer.New(source, s.filename))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	statements := sessionStatements(program)
+	matches := matchStatements(s.statements, statements)
+	dirty, changed := s.dirtyStatements(statements, matches)
+
+	if s.needsFullEvaluation(statements, matches) {
+		s.env = object.NewEnvironment()
+		for i := range statements {
+			dirty[i] = true
+		}
+		changed = make(map[string]bool)
+		for _, stmt := range append(s.statements, statements...) {
+			if stmt.binds != "" {
+				changed[stmt.binds] = true
+			}
+		}
+	} else {
+		// bindings which are gone must not be found by re-evaluated statements
+		for _, stmt := range s.statements {
+			if stmt.binds != "" && changed[stmt.binds] {
+				s.env.Delete(stmt.binds)
+			}
+		}
+	}
+
+	res := &UpdateResult{}
+	halted := false
+	for i, stmt := range statements {
+		if halted {
+			continue
+		}
+		if dirty[i] {
+			stmt.value = Eval(stmt.node, s.env)
+			stmt.evaluated = true
+			res.Evaluated++
+		} else {
+			old := s.statements[matches[i]]
+			stmt.value, stmt.evaluated = old.value, true
+		}
+		if stmt.value == nil {
+			continue
+		}
+		res.Result = stmt.value
+		switch value := stmt.value.(type) {
+		case *object.Return:
+			res.Result = value.Value
+			halted = true
+		case *object.Error:
+			halted = true
+		}
+	}
+
+	for _, stmt := range statements {
+		if stmt.binds != "" && changed[stmt.binds] {
+			res.Changed = append(res.Changed, stmt.binds)
+			delete(changed, stmt.binds)
+		}
+	}
+	for _, stmt := range s.statements {
+		if stmt.binds != "" && changed[stmt.binds] {
+			res.Changed = append(res.Changed, stmt.binds)
+			delete(changed, stmt.binds)
+		}
+	}
+
+	s.statements = statements
+	return res, nil
+}
+
+func sessionStatements(program *ast.Program) []*sessionStatement {
+	statements := make([]*sessionStatement, 0, len(program.Statements))
+	for _, stmt := range program.Statements {
+		statements = append(statements, newSessionStatement(stmt))
+	}
+	return statements
+}
+
+func newSessionStatement(node ast.Statement) *sessionStatement {
+	stmt := &sessionStatement{
+		node:   node,
+		source: fmt.Sprintf("%T %s", node, node.String()),
+		reads:  make(map[string]bool),
+	}
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		stmt.binds = node.Name.Value
+	case *ast.CellStatement:
+		stmt.binds = node.Name.Value
+	case *ast.ConstStatement:
+		stmt.binds = node.Name.Value
+	}
+	// every identifier counts as a read, even ones bound locally inside
+	// functions, which at worst re-evaluates a statement needlessly
+	ast.Walk(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			stmt.reads[ident.Value] = true
+		}
+		return true
+	})
+	return stmt
+}
+
+// matchStatements pairs every updated statement with an old statement with the
+// same source, keeping their order, using the longest common subsequence.
+// Unmatched statements are mapped to -1.
+func matchStatements(old, updated []*sessionStatement) []int {
+	lengths := make([][]int, len(old)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(updated)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(updated) - 1; j >= 0; j-- {
+			if old[i].source == updated[j].source {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	matches := make([]int, len(updated))
+	for j := range matches {
+		matches[j] = -1
+	}
+	for i, j := 0, 0; i < len(old) && j < len(updated); {
+		if old[i].source == updated[j].source {
+			matches[j] = i
+			i++
+			j++
+		} else if lengths[i+1][j] >= lengths[i][j+1] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return matches
+}
+
+// dirtyStatements finds the new statements which have to be evaluated, and
+// the names whose bindings change
+func (s *Session) dirtyStatements(statements []*sessionStatement, matches []int) (map[int]bool, map[string]bool) {
+	dirty := make(map[int]bool)
+	changed := make(map[string]bool)
+	kept := make(map[int]bool)
+	for i, stmt := range statements {
+		if matches[i] < 0 || !s.statements[matches[i]].evaluated {
+			dirty[i] = true
+			if stmt.binds != "" {
+				changed[stmt.binds] = true
+			}
+		} else {
+			kept[matches[i]] = true
+		}
+	}
+	for i, stmt := range s.statements {
+		if !kept[i] && stmt.binds != "" {
+			changed[stmt.binds] = true
+		}
+	}
+
+	// references can point forwards, e.g. from a function body to a function
+	// defined later, so spread the changes until nothing new is dirty
+	for spreading := true; spreading; {
+		spreading = false
+		for i, stmt := range statements {
+			if dirty[i] {
+				continue
+			}
+			for name := range stmt.reads {
+				if changed[name] {
+					dirty[i] = true
+					spreading = true
+					if stmt.binds != "" {
+						changed[stmt.binds] = true
+					}
+					break
+				}
+			}
+		}
+	}
+	return dirty, changed
+}
+
+func (s *Session) needsFullEvaluation(statements []*sessionStatement, matches []int) bool {
+	bound := make(map[string]bool)
+	for i, stmt := range statements {
+		if stmt.binds != "" {
+			if bound[stmt.binds] {
+				return true
+			}
+			bound[stmt.binds] = true
+		}
+		if _, ok := stmt.node.(*ast.ImportStatement); ok && matches[i] < 0 {
+			return true
+		}
+		switch stmt.node.(type) {
+		case *ast.WhileStatement, *ast.ForStatement:
+			return true
+		}
+		if assigns(stmt.node) {
+			return true
+		}
+	}
+
+	kept := make(map[int]bool)
+	for _, m := range matches {
+		kept[m] = true
+	}
+	for i, stmt := range s.statements {
+		if _, ok := stmt.node.(*ast.ImportStatement); ok && !kept[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// assigns reports whether a statement assigns to a name, even inside a
+// function, which can change bindings other statements see when called
+func assigns(node ast.Node) bool {
+	found := false
+	ast.Walk(node, func(n ast.Node) bool {
+		if _, ok := n.(*ast.AssignExpression); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,220 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"koko/ast"
+	"koko/lexer"
+	"koko/object"
+	"koko/parser"
+	"sort"
+	"strings"
+)
+
+// SliceProgram runs a program and returns the lines of its source which
+// contributed to its result, eliding everything else. With line > 0 the
+// slice is taken of the value of the top level statement on that line, e.g.
+// a let binding, instead of the result. Whatever the program prints is
+// discarded.
+//
+// A statement is kept when a value the result depends on was created in it.
+// Of a kept statement, the lines are shown on which such a value was created,
+// or which start a statement, function or if expression containing one, so
+// that they can still be read in context. Statements which aren't kept are
+// cut out of the lines shown.
+func SliceProgram(programStr string, filename string, line int) (string, error) {
+	p := parser.New(lexer.New(programStr, filename))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	target, targetStmt, err := evalSliceTarget(program, line)
+	if err != nil {
+		return "", err
+	}
+
+	creators := make(map[ast.Node]bool)
+	for obj := range object.GetAllDependencies(target) {
+		creator := obj.GetCreatorNode()
+		if length, ok := creator.(*ast.LengthNode); ok {
+			creator = length.Child
+		}
+		if creator != nil {
+			creators[creator] = true
+		}
+	}
+
+	lines := make(map[int]bool)
+	cuts := make(map[int][]lineCut)
+	ast.Walk(program, func(node ast.Node) bool {
+		span := node.Span()
+		if span.Empty() || span.File != filename {
+			return true
+		}
+		kept := creators[node] || (encloses(node) && containsAny(node, creators))
+		if _, ok := node.(ast.Statement); ok && node != targetStmt && !kept {
+			if _, block := node.(*ast.BlockStatement); !block {
+				return false
+			}
+		}
+		if kept {
+			lines[span.BeginLine] = true
+		}
+		for _, cut := range unkeptStatements(node, creators, targetStmt) {
+			cuts[cut.line] = append(cuts[cut.line], cut)
+		}
+		return true
+	})
+	lines[targetStmt.Span().BeginLine] = true
+	return formatSlice(programStr, lines, cuts), nil
+}
+
+// lineCut is the part of a line taken by a statement which isn't kept: the
+// runes from begin up to end, or to the end of the line when end < 0
+type lineCut struct {
+	line       int
+	begin, end int
+}
+
+// unkeptStatements finds the statements directly in node which aren't kept,
+// returning the part of the line each of them starts on
+func unkeptStatements(node ast.Node, creators map[ast.Node]bool, targetStmt ast.Statement) []lineCut {
+	var statements []ast.Statement
+	switch node := node.(type) {
+	case *ast.Program:
+		statements = node.Statements
+	case *ast.BlockStatement:
+		statements = node.Statements
+	default:
+		return nil
+	}
+	var cuts []lineCut
+	for i, statement := range statements {
+		span := statement.Span()
+		if span.Empty() || statement == targetStmt || containsAny(statement, creators) {
+			continue
+		}
+		cut := lineCut{line: span.BeginLine, begin: column(span), end: -1}
+		if i+1 < len(statements) {
+			next := statements[i+1].Span()
+			if !next.Empty() && next.BeginLine == span.BeginLine {
+				cut.end = column(next)
+			}
+		}
+		cuts = append(cuts, cut)
+	}
+	return cuts
+}
+
+// column is the index of the rune a span begins at in its line. The lexer
+// counts positions on the first line from its start and on later lines from
+// the line break before them.
+func column(span ast.Span) int {
+	if span.BeginLine > 1 {
+		return span.BeginPos - 1
+	}
+	return span.BeginPos
+}
+
+// evalSliceTarget evaluates the program statement by statement in a new
+// environment, which traces dependencies and discards what the program
+// prints, returning the value of the statement on line, or of the last
+// statement
+func evalSliceTarget(program *ast.Program, line int) (object.Object, ast.Statement, error) {
+	env := object.NewEnvironment()
+	env.Runtime().Out = ioutil.Discard
+	var target object.Object
+	var targetStmt ast.Statement
+	for _, statement := range program.Statements {
+		res := Eval(statement, env)
+		if isError(res) {
+			return nil, nil, errors.New(res.Inspect())
+		}
+		if res == nil {
+			continue
+		}
+		if line <= 0 || statement.Span().BeginLine == line {
+			target, targetStmt = res, statement
+		}
+		if ret, ok := res.(*object.Return); ok {
+			target = ret.Value
+			break
+		}
+		if line > 0 && targetStmt != nil {
+			break
+		}
+	}
+	if target == nil {
+		if line > 0 {
+			return nil, nil, fmt.Errorf("no statement with a value starts on line %d", line)
+		}
+		return nil, nil, errors.New("program has no result")
+	}
+	return target, targetStmt, nil
+}
+
+// encloses reports whether node is kept as context for the values inside it
+func encloses(node ast.Node) bool {
+	switch node.(type) {
+	case ast.Statement, *ast.FunctionLiteral, *ast.PureFunctionLiteral, *ast.IfExpression:
+		return true
+	}
+	return false
+}
+
+func containsAny(node ast.Node, nodes map[ast.Node]bool) bool {
+	found := false
+	ast.Walk(node, func(child ast.Node) bool {
+		if nodes[child] {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func formatSlice(programStr string, lines map[int]bool, cuts map[int][]lineCut) string {
+	numbers := make([]int, 0, len(lines))
+	for n := range lines {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	source := strings.Split(programStr, "\n")
+	var out strings.Builder
+	previous := 0
+	for _, n := range numbers {
+		if n < 1 || n > len(source) {
+			continue
+		}
+		if n > previous+1 {
+			out.WriteString("     ...\n")
+		}
+		text := cutLine(source[n-1], cuts[n])
+		fmt.Fprintf(&out, "%4d | %s\n", n, strings.TrimRight(text, " \t\r"))
+		previous = n
+	}
+	if previous < len(source) && strings.TrimSpace(strings.Join(source[previous:], "")) != "" {
+		out.WriteString("     ...\n")
+	}
+	return out.String()
+}
+
+// cutLine removes the parts of text taken by statements which aren't kept
+func cutLine(text string, cuts []lineCut) string {
+	runes := []rune(text)
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i].begin > cuts[j].begin })
+	for _, cut := range cuts {
+		end := cut.end
+		if end < 0 || end > len(runes) {
+			end = len(runes)
+		}
+		if cut.begin < 0 || cut.begin >= end {
+			continue
+		}
+		runes = append(runes[:cut.begin], runes[end:]...)
+	}
+	return string(runes)
+}
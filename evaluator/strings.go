@@ -0,0 +1,142 @@
+package evaluator
+
+import (
+	"koko/ast"
+	"koko/object"
+)
+
+// evalStringIndexExpression returns the character at index in a string, as
+// a string, counting in characters rather than bytes. Like arrays, indexes
+// out of range give nil.
+func evalStringIndexExpression(rt *object.Runtime, str *object.String, index *object.Integer) object.Object {
+	chars := []rune(str.Value)
+	idx := index.Value
+
+	var res object.Object
+	if idx < 0 || idx >= int64(len(chars)) {
+		res = rt.Copy(object.NIL)
+	} else {
+		res = &object.String{Value: string(chars[idx])}
+	}
+	rt.AddDependency(res, str)
+	rt.AddDependency(res, index)
+	return res
+}
+
+// evalSliceExpression takes the characters of a string, or the elements of
+// an array, from the start bound up to but not including the end bound
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	rt := env.Runtime()
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if left.Type() != object.STRING_OBJ && left.Type() != object.ARRAY_OBJ {
+		return newError("slice operator not supported: %s", left.Type())
+	}
+	start, err := evalSliceBound(node.Start, env)
+	if err != nil {
+		return err
+	}
+	end, err := evalSliceBound(node.End, env)
+	if err != nil {
+		return err
+	}
+	if array, ok := left.(*object.Array); ok {
+		return sliceArray(rt, array, start, end)
+	}
+	return sliceString(rt, left.(*object.String), start, end)
+}
+
+// evalSliceBound evaluates a bound of a slice, which is nil when it was left
+// out
+func evalSliceBound(bound ast.Expression, env *object.Environment) (*object.Integer, object.Object) {
+	if bound == nil {
+		return nil, nil
+	}
+	val := Eval(bound, env)
+	if isError(val) {
+		return nil, val
+	}
+	integer, ok := val.(*object.Integer)
+	if !ok {
+		return nil, newError("slice bounds must be INTEGER, got %s", val.Type())
+	}
+	return integer, nil
+}
+
+func sliceString(rt *object.Runtime, str *object.String, start, end *object.Integer) object.Object {
+	chars := []rune(str.Value)
+	from, to := sliceRange(start, end, len(chars))
+	res := &object.String{Value: string(chars[from:to])}
+	rt.AddDependency(res, str)
+	for _, bound := range []*object.Integer{start, end} {
+		if bound != nil {
+			rt.AddDependency(res, bound)
+		}
+	}
+	return res
+}
+
+// sliceArray copies the elements of array between the bounds into a new
+// array. Like indexing, which element ends up where depends on the start
+// bound, but not on the end bound, which only decides the length. The
+// length of array decides it too, when the end bound is left out or out of
+// range.
+func sliceArray(rt *object.Runtime, array *object.Array, start, end *object.Integer) object.Object {
+	from, to := sliceRange(start, end, len(array.Elements))
+	elements := make([]object.Object, 0, to-from)
+	for _, el := range array.Elements[from:to] {
+		elCopy := rt.Copy(el)
+		rt.AddDependency(elCopy, &array.Offset)
+		if start != nil {
+			rt.AddDependency(elCopy, start)
+			if elArr, ok := elCopy.(*object.Array); ok {
+				rt.AddDependency(&elArr.Offset, start)
+			}
+			if elHash, ok := elCopy.(*object.Hash); ok {
+				rt.AddDependency(&elHash.Offset, start)
+			}
+		}
+		elements = append(elements, elCopy)
+	}
+
+	res := rt.CreateArray(elements)
+	rt.AddDependency(&res.Offset, &array.Offset)
+	for _, bound := range []*object.Integer{start, end} {
+		if bound != nil {
+			rt.AddDependency(&res.Length, bound)
+		}
+	}
+	if end == nil || end.Value != int64(to) {
+		rt.AddDependency(&res.Length, &array.Length)
+	}
+	return res
+}
+
+// sliceRange finds the positions a slice of something of length runs
+// between. Bounds out of range are moved to the nearest end, so that slicing
+// never fails, and a start past the end gives an empty slice.
+func sliceRange(start, end *object.Integer, length int) (int, int) {
+	from, to := 0, length
+	if start != nil {
+		from = clampBound(start.Value, length)
+	}
+	if end != nil {
+		to = clampBound(end.Value, length)
+	}
+	if from > to {
+		from = to
+	}
+	return from, to
+}
+
+func clampBound(bound int64, length int) int {
+	if bound < 0 {
+		return 0
+	}
+	if bound > int64(length) {
+		return length
+	}
+	return int(bound)
+}
@@ -1,15 +1,22 @@
 package lexer
 
-import "koko/token"
+import (
+	"koko/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
 	input            string
 	position         int  // current position in input (points to current char)
 	readPosition     int  // current reading position in input (after current char)
-	ch               byte // current char under examination
+	ch               rune // current char under examination
 	lastLineBreakPos int  // the position of the most recent line break
 	lineNumber       int
 	filename         string
+	interpolations   []int // open braces in each interpolation being read, innermost last
 }
 
 func New(input string, filename string) *Lexer {
@@ -18,22 +25,27 @@ func New(input string, filename string) *Lexer {
 	return l
 }
 
+// readChar moves on to the next character, decoding it from UTF-8. Positions
+// in the input are in bytes, so they move by the width of the character.
 func (l *Lexer) readChar() {
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
-	tok.Context = token.ContextData{LineNumber: l.lineNumber, File: l.filename, PositionInLine: l.position - l.lastLineBreakPos}
 
 	l.skipWhitespace()
+	// the context is taken after skipping whitespace so that it points at
+	// the token itself rather than the end of the previous one
+	tok.Context = l.context()
 
 	switch l.ch {
 	case '=':
@@ -41,9 +53,9 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(l, token.COMMA, l.ch)
 	case '+':
-		tok = newToken(l, token.PLUS, l.ch)
+		tok = twoChar(l, token.PLUS, token.PLUS_ASSIGN, '=')
 	case '-':
-		tok = newToken(l, token.MINUS, l.ch)
+		tok = twoChar(l, token.MINUS, token.MINUS_ASSIGN, '=')
 	case '%':
 		tok = newToken(l, token.PERCENT, l.ch)
 	case '!':
@@ -55,26 +67,44 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(l, token.SLASH, l.ch)
 		}
 	case '*':
-		tok = newToken(l, token.ASTERISK, l.ch)
+		tok = twoChar(l, token.ASTERISK, token.ASTERISK_ASSIGN, '=')
 	case '<':
-		tok = newToken(l, token.LT, l.ch)
+		tok = twoChar(l, token.LT, token.LT_EQ, '=')
 	case '>':
-		tok = newToken(l, token.GT, l.ch)
+		tok = twoChar(l, token.GT, token.GT_EQ, '=')
+	case '&':
+		tok = twoChar(l, token.ILLEGAL, token.AND, '&')
+	case '|':
+		tok = twoChar(l, token.ILLEGAL, token.OR, '|')
 	case '(':
 		tok = newToken(l, token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(l, token.RPAREN, l.ch)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1] += 1
+		}
 		tok = newToken(l, token.LBRACE, l.ch)
 	case '}':
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1] == 0 {
+			// the end of an interpolation, so the string goes on
+			l.interpolations = l.interpolations[:n-1]
+			tok.Type, tok.Literal = l.readString(true)
+			break
+		}
+		if n > 0 {
+			l.interpolations[n-1] -= 1
+		}
 		tok = newToken(l, token.RBRACE, l.ch)
 	case ';':
 		tok = newToken(l, token.SEMICOLON, l.ch)
 	case ':':
 		tok = newToken(l, token.COLON, l.ch)
 	case '"':
-		tok.Literal = l.readString()
-		tok.Type = token.STRING
+		tok.Type, tok.Literal = l.readString(false)
+	case '`':
+		tok.Type, tok.Literal = l.readRawString()
 	case '[':
 		tok = newToken(l, token.LBRACKET, l.ch)
 	case ']':
@@ -109,19 +139,126 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch == '?' || ch == '!'
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_' || ch == '?' || ch == '!'
 }
 
-func (l *Lexer) readString() string {
-	l.readChar()
-	position := l.position
+// readString reads a string up to its closing quote, or up to the next
+// `${` when it interpolates an expression, and decodes its escape sequences.
+// continued is set when reading on after an interpolation. Strings which
+// aren't closed, or contain an escape sequence which doesn't exist, give an
+// ILLEGAL token describing the problem.
+func (l *Lexer) readString(continued bool) (token.TokenType, string) {
+	var out strings.Builder
+	problem := ""
+	for {
+		l.readStringChar()
+		switch l.ch {
+		case 0:
+			return token.ILLEGAL, "unterminated string"
+		case '"':
+			if problem != "" {
+				return token.ILLEGAL, problem
+			}
+			if continued {
+				return token.STRING_END, out.String()
+			}
+			return token.STRING, out.String()
+		case '$':
+			if l.peekChar() != '{' {
+				out.WriteRune(l.ch)
+				continue
+			}
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+			if problem != "" {
+				return token.ILLEGAL, problem
+			}
+			if continued {
+				return token.STRING_MIDDLE, out.String()
+			}
+			return token.STRING_START, out.String()
+		case '\\':
+			decoded, ok := l.readEscape()
+			if !ok && problem == "" {
+				problem = "invalid escape sequence " + decoded
+			}
+			out.WriteString(decoded)
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
 
-	for l.ch != '"' {
+// readEscape decodes the escape sequence starting at the current backslash,
+// leaving the lexer on its last character. Sequences which don't exist are
+// returned as they were written.
+func (l *Lexer) readEscape() (string, bool) {
+	switch l.peekChar() {
+	case 'n':
+		l.readChar()
+		return "\n", true
+	case 't':
 		l.readChar()
+		return "\t", true
+	case '"':
+		l.readChar()
+		return "\"", true
+	case '\\':
+		l.readChar()
+		return "\\", true
+	case '$':
+		l.readChar()
+		return "$", true
+	case 'u':
+		l.readChar()
+		if l.peekChar() != '{' {
+			return "\\u", false
+		}
+		l.readChar()
+		start := l.position + 1
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+		}
+		digits := l.input[start : l.position+1]
+		if l.peekChar() != '}' {
+			return "\\u{" + digits, false
+		}
+		l.readChar()
+		code, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || len(digits) > 6 || code > 0x10FFFF || (code >= 0xD800 && code <= 0xDFFF) {
+			return "\\u{" + digits + "}", false
+		}
+		return string(rune(code)), true
+	case 0:
+		return "\\", false
 	}
+	l.readStringChar()
+	return "\\" + string(l.ch), false
+}
 
-	return l.input[position:l.position]
+// readRawString reads a string between backticks as it is written, across
+// lines and without escape sequences
+func (l *Lexer) readRawString() (token.TokenType, string) {
+	l.readStringChar()
+	position := l.position
+	for l.ch != '`' {
+		if l.ch == 0 {
+			return token.ILLEGAL, "unterminated raw string"
+		}
+		l.readStringChar()
+	}
+	return token.STRING, l.input[position:l.position]
+}
+
+// readStringChar reads the next character of a string literal, counting the
+// lines strings span
+func (l *Lexer) readStringChar() {
+	l.readChar()
+	if l.ch == '\n' {
+		l.lineNumber += 1
+		l.lastLineBreakPos = l.position
+	}
 }
 
 func (l *Lexer) readComment() token.Token {
@@ -133,7 +270,7 @@ func (l *Lexer) readComment() token.Token {
 		l.readChar()
 	}
 
-	context := token.ContextData{LineNumber: l.lineNumber, File: l.filename, PositionInLine: l.position - l.lastLineBreakPos}
+	context := l.context()
 	return token.Token{
 		Type:    token.COMMENT,
 		Literal: l.input[position:l.position],
@@ -143,6 +280,7 @@ func (l *Lexer) readComment() token.Token {
 
 func (l *Lexer) readNumber() token.Token {
 	position := l.position
+	context := l.context()
 
 	var tokenType token.TokenType = token.INT
 
@@ -162,7 +300,6 @@ func (l *Lexer) readNumber() token.Token {
 		}
 	}
 
-	context := token.ContextData{LineNumber: l.lineNumber, File: l.filename, PositionInLine: l.position - l.lastLineBreakPos}
 	return token.Token{
 		Type:    tokenType,
 		Literal: l.input[position:l.position],
@@ -170,16 +307,20 @@ func (l *Lexer) readNumber() token.Token {
 	}
 }
 
-func isDigit(ch byte) bool {
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func isDecimal(ch byte) bool {
+func isDecimal(ch rune) bool {
 	return '.' == ch
 }
 
-func newToken(l *Lexer, tokenType token.TokenType, ch byte) token.Token {
-	context := token.ContextData{LineNumber: l.lineNumber, File: l.filename, PositionInLine: l.position - l.lastLineBreakPos}
+func newToken(l *Lexer, tokenType token.TokenType, ch rune) token.Token {
+	context := l.context()
 	return token.Token{Type: tokenType, Literal: string(ch), Context: context}
 }
 
@@ -193,20 +334,33 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) peekChar() byte {
+// context gives the position of the current character, counting columns in
+// characters rather than bytes
+func (l *Lexer) context() token.ContextData {
+	end := l.position
+	if end > len(l.input) {
+		// past the end of the input, where EOF is
+		end = len(l.input)
+	}
+	column := utf8.RuneCountInString(l.input[l.lastLineBreakPos:end]) + l.position - end
+	return token.ContextData{LineNumber: l.lineNumber, File: l.filename, PositionInLine: column}
+}
+
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	} else {
-		return l.input[l.readPosition]
+		ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+		return ch
 	}
 }
 
-func twoChar(l *Lexer, firstToken token.TokenType, secondToken token.TokenType, secondChar byte) token.Token {
+func twoChar(l *Lexer, firstToken token.TokenType, secondToken token.TokenType, secondChar rune) token.Token {
 	if l.peekChar() == secondChar {
 		ch := l.ch
 		l.readChar()
 		literal := string(ch) + string(l.ch)
-		context := token.ContextData{LineNumber: l.lineNumber, File: l.filename, PositionInLine: l.position - l.lastLineBreakPos}
+		context := l.context()
 		return token.Token{Type: secondToken, Literal: literal, Context: context}
 	} else {
 		return newToken(l, firstToken, l.ch)
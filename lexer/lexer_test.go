@@ -34,6 +34,9 @@ func TestNextToken(t *testing.T) {
 
 	10 == 10;
 	10 != 9;
+	a && b || c & d;
+	1 <= 2 >= 3;
+	const c = 1; c += 2 -= 3 *= 4;
 	"foobar"
 	"foo bar"
 	[1, 2];
@@ -137,6 +140,33 @@ func TestNextToken(t *testing.T) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.ILLEGAL, "&"},
+		{token.IDENT, "d"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "1"},
+		{token.LT_EQ, "<="},
+		{token.INT, "2"},
+		{token.GT_EQ, ">="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.CONST, "const"},
+		{token.IDENT, "c"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "c"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "2"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "3"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
 		{token.STRING, "foobar"},
 		{token.STRING, "foo bar"},
 		{token.LBRACKET, "["},
@@ -169,3 +199,151 @@ func TestNextToken(t *testing.T) {
 	}
 
 }
+
+func TestTokenLines(t *testing.T) {
+	input := `let a = 1;
+  foo
+"bar"
+    42`
+	expectedLines := []int{1, 1, 1, 1, 1, 2, 3, 4}
+
+	l := New(input, "")
+
+	for i, line := range expectedLines {
+		tok := l.NextToken()
+		if tok.Context.LineNumber != line {
+			t.Fatalf("tests[%d] - line of %q wrong. expected=%d, got=%d",
+				i, tok.Literal, line, tok.Context.LineNumber)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := `let café = "naïve 😀";
+größe + 名前2`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     int
+	}{
+		{token.LET, "let", 0},
+		{token.IDENT, "café", 4},
+		{token.ASSIGN, "=", 9},
+		{token.STRING, "naïve 😀", 11},
+		{token.SEMICOLON, ";", 20},
+		{token.IDENT, "größe", 1},
+		{token.PLUS, "+", 7},
+		{token.IDENT, "名前2", 9},
+		{token.EOF, "", 12},
+	}
+
+	l := New(input, "")
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Context.PositionInLine != tt.expectedPos {
+			t.Fatalf("tests[%d] - position of %q wrong. expected=%d, got=%d",
+				i, tok.Literal, tt.expectedPos, tok.Context.PositionInLine)
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"plain"`, token.STRING, "plain"},
+		{`"a\nb\tc"`, token.STRING, "a\nb\tc"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"\u{e9}\u{1F600}"`, token.STRING, "é😀"},
+		{"`raw \\n \"text\"`", token.STRING, `raw \n "text"`},
+		{"`two\nlines`", token.STRING, "two\nlines"},
+		{`"never closed`, token.ILLEGAL, "unterminated string"},
+		{"`never closed", token.ILLEGAL, "unterminated raw string"},
+		{`"bad \q escape"`, token.ILLEGAL, `invalid escape sequence \q`},
+		{`"\u{110000}"`, token.ILLEGAL, `invalid escape sequence \u{110000}`},
+		{`"\u{zz}"`, token.ILLEGAL, `invalid escape sequence \u{`},
+		{`"ends with \`, token.ILLEGAL, "unterminated string"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input, "")
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Errorf("tokentype wrong for %s. expected=%q, got=%q", tt.input, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("literal wrong for %s. expected=%q, got=%q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("expected EOF after %s. got=%q", tt.input, next.Literal)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	input := `"a ${x} b ${ {"k": "${y}"}["k"] } c" "\${z} $5"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_START, "a "},
+		{token.IDENT, "x"},
+		{token.STRING_MIDDLE, " b "},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.STRING_START, ""},
+		{token.IDENT, "y"},
+		{token.STRING_END, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.STRING_END, " c"},
+		{token.STRING, "${z} $5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input, "")
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStringLiteralLines(t *testing.T) {
+	input := "`one\ntwo\nthree` x \"a\nb\" y"
+	expectedLines := []int{1, 3, 3, 4}
+
+	l := New(input, "")
+
+	for i, line := range expectedLines {
+		tok := l.NextToken()
+		if tok.Context.LineNumber != line {
+			t.Fatalf("tests[%d] - line of %q wrong. expected=%d, got=%d",
+				i, tok.Literal, line, tok.Context.LineNumber)
+		}
+	}
+}
@@ -1,18 +1,199 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"koko/evaluator"
+	"koko/object"
 	"koko/repl"
 	"os"
 	"os/user"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "slice" {
+		runSlice(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		runLint(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "depdiff" {
+		runDepdiff(os.Args[2:])
+		return
+	}
+
+	cacheDir := flag.String("cache-dir", "", "directory to keep pure function results in across runs")
+	cacheLimit := flag.Int("cache-limit", 0, "maximum number of results cached by all pure functions together, 0 for no limit")
+	cachePolicy := flag.String("cache-policy", "lru", "which cached results to evict when over -cache-limit: lru or lfu")
+	trace := flag.Bool("trace", true, "record dependencies; turning this off runs scripts faster, but dependency builtins can't be used")
+	htmlFile := flag.String("html", "", "write an interactive view of the dependency graph of a script's result to this HTML file")
+	flag.Parse()
+	policy, err := object.ParseEvictionPolicy(*cachePolicy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	opts := evaluator.EvalOptions{Trace: *trace, CacheDir: *cacheDir, CacheLimit: *cacheLimit, CachePolicy: policy}
+
+	if flag.NArg() > 0 {
+		if *htmlFile != "" && !*trace {
+			fmt.Fprintln(os.Stderr, "-html needs dependency tracing, which -trace=false turns off")
+			os.Exit(2)
+		}
+		runFile(flag.Arg(0), opts, *htmlFile)
+		return
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("Hello %s! This is the Koko programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.Start(os.Stdin, os.Stdout, opts)
+}
+
+func runFile(fileLocation string, opts evaluator.EvalOptions, htmlFile string) {
+	data, err := ioutil.ReadFile(fileLocation)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	env := object.NewEnvironment()
+	evaluated := evaluator.LoadProgramWithOptions(string(data), fileLocation, env, opts)
+	if evaluated == nil {
+		return
+	}
+	if evaluated.Type() == object.ERROR_OBJ {
+		fmt.Fprintln(os.Stderr, evaluated.Inspect())
+		os.Exit(1)
+	}
+	fmt.Println(evaluated.Inspect())
+
+	if htmlFile != "" {
+		page, err := evaluator.DependencyGraphHTML(env.Runtime(), evaluated)
+		if err == nil {
+			err = ioutil.WriteFile(htmlFile, []byte(page), 0644)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// runSlice implements `koko slice file.koko [--line N]`
+func runSlice(args []string) {
+	flags := flag.NewFlagSet("slice", flag.ExitOnError)
+	line := flags.Int("line", 0, "slice the value of the statement on this line instead of the result")
+	files := parseInterspersed(flags, args)
+	if len(files) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: koko slice file.koko [--line N]")
+		os.Exit(2)
+	}
+
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	slice, err := evaluator.SliceProgram(string(data), files[0], *line)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Print(slice)
+}
+
+// runDepdiff implements `koko depdiff old.koko new.koko [--json]`. Like
+// diff, it exits with 1 when the dependency graphs differ and 2 on errors.
+func runDepdiff(args []string) {
+	flags := flag.NewFlagSet("depdiff", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the differences as JSON")
+	files := parseInterspersed(flags, args)
+	if len(files) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: koko depdiff old.koko new.koko [--json]")
+		os.Exit(2)
+	}
+
+	sources := make([]string, 2)
+	for i, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		sources[i] = string(data)
+	}
+	diff, err := evaluator.DiffPrograms(sources[0], files[0], sources[1], files[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *asJSON {
+		out, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Println(string(out))
+	} else {
+		fmt.Print(diff.String())
+	}
+	if !diff.Empty() {
+		os.Exit(1)
+	}
+}
+
+// runLint implements `koko lint --dynamic file.koko...`. It exits with 1 when
+// there are findings and 2 on errors.
+func runLint(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	dynamic := flags.Bool("dynamic", false, "run the files and report function inputs which never influenced a result")
+	files := parseInterspersed(flags, args)
+	if len(files) == 0 || !*dynamic {
+		fmt.Fprintln(os.Stderr, "usage: koko lint --dynamic file.koko...")
+		os.Exit(2)
+	}
+
+	linter := evaluator.NewDynamicLinter()
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if err := linter.Run(string(data), file); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	findings := linter.Findings()
+	for _, finding := range findings {
+		fmt.Println(finding)
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseInterspersed parses flags which may come after positional arguments,
+// returning the positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	positional := []string{}
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
 }
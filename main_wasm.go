@@ -17,6 +17,22 @@ func main() {
 		}()
 		return nil
 	}))
+	// updateProgram re-evaluates only what changed since the last update
+	session := evaluator.NewSession("")
+	js.Global().Set("updateProgram", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		go func() {
+			programStr := args[0].String()
+			res, err := session.Update(programStr)
+			if err != nil {
+				js.Global().Set("output", err.Error())
+			} else if res.Result != nil {
+				js.Global().Set("output", res.Result.Inspect())
+			} else {
+				js.Global().Set("output", "")
+			}
+		}()
+		return nil
+	}))
 	fmt.Println("interpreter successfully loaded yay")
 	// wait forever without spinning (I think)
 	<-c
@@ -0,0 +1,90 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encode returns a canonical, type-tagged encoding of the structure of obj.
+// Two objects have the same encoding exactly when they hold the same value,
+// whatever their dependencies, their creator nodes or the iteration order of
+// hash pairs. Strings are length prefixed so that no two values collide, e.g.
+// "1" and 1, or ["a,b"] and ["a", "b"].
+//
+// Functions and builtins have no structural value, so they are encoded by
+// identity. Such encodings are only meaningful within a single run.
+func Encode(obj Object) string {
+	var out strings.Builder
+	encode(obj, &out)
+	return out.String()
+}
+
+// StructurallyEqual reports whether two objects hold the same value
+func StructurallyEqual(a Object, b Object) bool {
+	return Encode(a) == Encode(b)
+}
+
+func encode(obj Object, out *strings.Builder) {
+	switch obj := obj.(type) {
+	case nil:
+		out.WriteString("-")
+	case *Integer:
+		out.WriteString("i" + strconv.FormatInt(obj.Value, 10) + ";")
+	case *Float:
+		value := obj.Value
+		if value == 0 {
+			// -0.0 and 0.0 are equal values
+			value = 0
+		}
+		out.WriteString("f" + strconv.FormatFloat(value, 'g', -1, 64) + ";")
+	case *Boolean:
+		out.WriteString("b" + strconv.FormatBool(obj.Value) + ";")
+	case *String:
+		encodeString("s", obj.Value, out)
+	case *Nil:
+		out.WriteString("n;")
+	case *Error:
+		encodeString("e", obj.Message, out)
+	case *Return:
+		out.WriteString("r")
+		encode(obj.Value, out)
+	case *Array:
+		out.WriteString("a" + strconv.Itoa(len(obj.Elements)) + "[")
+		for _, el := range obj.Elements {
+			encode(el, out)
+		}
+		out.WriteString("]")
+	case *Hash:
+		pairs := make([]string, 0, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, Encode(pair.Key)+Encode(pair.Value))
+		}
+		sort.Strings(pairs)
+		out.WriteString("h" + strconv.Itoa(len(pairs)) + "{")
+		for _, pair := range pairs {
+			out.WriteString(pair)
+		}
+		out.WriteString("}")
+	case *Trace:
+		out.WriteString("t" + strconv.Itoa(len(obj.Deps)) + "[")
+		encode(obj.Result, out)
+		for _, d := range obj.Deps {
+			encodeString("s", d, out)
+		}
+		out.WriteString("]")
+	case *Function:
+		out.WriteString(fmt.Sprintf("F%p/%p;", obj.Body, obj.Env))
+	case *PureFunction:
+		out.WriteString(fmt.Sprintf("P%p/%p;", obj.Body, obj.Env))
+	case *Builtin:
+		out.WriteString(fmt.Sprintf("B%p;", obj.Fn))
+	default:
+		out.WriteString(fmt.Sprintf("%s%p;", obj.Type(), obj))
+	}
+}
+
+func encodeString(tag string, value string, out *strings.Builder) {
+	out.WriteString(tag + strconv.Itoa(len(value)) + ":" + value)
+}
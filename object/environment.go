@@ -1,13 +1,30 @@
 package object
 
+import (
+	"fmt"
+	"koko/ast"
+)
+
+// NewEnvironment creates a scope with a runtime of its own
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, runtime: NewRuntime()}
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    map[string]Object
+	outer    *Environment
+	watchers map[string][]*watcher
+	consts   map[string]ast.Node
+	runtime  *Runtime
+}
+
+// Runtime returns the runtime the scope is evaluated with
+func (e *Environment) Runtime() *Runtime { return e.runtime }
+
+type watcher struct {
+	notify  func(val Object) Object
+	stopped bool
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -18,13 +35,123 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// Set binds name in this scope and notifies whatever watches the binding.
+// It returns val, or the first error a watcher returned. Constants of this
+// scope can't be bound again.
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val.Copy()
+	if _, ok := e.consts[name]; ok {
+		return &Error{Message: fmt.Sprintf("can't bind constant `%s` again", name)}
+	}
+	return e.set(name, val)
+}
+
+// SetConst binds name in this scope like Set, and makes the binding a
+// constant. Only binder, the statement which bound the constant, can bind it
+// again, as it does every time a loop runs it.
+func (e *Environment) SetConst(name string, val Object, binder ast.Node) Object {
+	if prev, ok := e.consts[name]; ok && prev != binder {
+		return &Error{Message: fmt.Sprintf("can't bind constant `%s` again", name)}
+	}
+	res := e.set(name, val)
+	if res.Type() == ERROR_OBJ {
+		return res
+	}
+	if e.consts == nil {
+		e.consts = make(map[string]ast.Node)
+	}
+	e.consts[name] = binder
+	return res
+}
+
+// Assign binds name again in the nearest scope which binds it, rather than
+// in this one. Names which aren't bound anywhere and constants can't be
+// assigned to.
+func (e *Environment) Assign(name string, val Object) Object {
+	for scope := e; scope != nil; scope = scope.outer {
+		if _, ok := scope.store[name]; !ok {
+			continue
+		}
+		if _, ok := scope.consts[name]; ok {
+			return &Error{Message: fmt.Sprintf("can't assign to constant `%s`", name)}
+		}
+		return scope.set(name, val)
+	}
+	return &Error{Message: "identifier not found: " + name}
+}
+
+func (e *Environment) set(name string, val Object) Object {
+	stored := e.runtime.Copy(val)
+	e.store[name] = stored
+	if len(e.watchers[name]) == 0 {
+		return val
+	}
+	// watchers may start or stop watching while being notified
+	watchers := append([]*watcher{}, e.watchers[name]...)
+	for _, w := range watchers {
+		if w.stopped {
+			continue
+		}
+		if res := w.notify(stored); res != nil && res.Type() == ERROR_OBJ {
+			return res
+		}
+	}
 	return val
 }
 
+// Watch calls notify with the new value whenever name is bound again in the
+// scope which binds it now, or in this scope if nothing binds it yet. It
+// returns a function which stops watching.
+func (e *Environment) Watch(name string, notify func(val Object) Object) func() {
+	scope := e
+	for scope != nil {
+		if _, ok := scope.store[name]; ok {
+			break
+		}
+		scope = scope.outer
+	}
+	if scope == nil {
+		scope = e
+	}
+	if scope.watchers == nil {
+		scope.watchers = make(map[string][]*watcher)
+	}
+	w := &watcher{notify: notify}
+	scope.watchers[name] = append(scope.watchers[name], w)
+	return func() {
+		w.stopped = true
+		watchers := scope.watchers[name][:0]
+		for _, other := range scope.watchers[name] {
+			if other != w {
+				watchers = append(watchers, other)
+			}
+		}
+		scope.watchers[name] = watchers
+	}
+}
+
+// Each calls f for every binding visible from this scope, skipping those
+// shadowed by an inner scope
+func (e *Environment) Each(f func(name string, val Object)) {
+	seen := make(map[string]bool)
+	for scope := e; scope != nil; scope = scope.outer {
+		for name, val := range scope.store {
+			if !seen[name] {
+				seen[name] = true
+				f(name, val)
+			}
+		}
+	}
+}
+
+// Delete removes a binding from this scope, leaving bindings of the same
+// name in outer scopes alone
+func (e *Environment) Delete(name string) {
+	delete(e.store, name)
+	delete(e.consts, name)
+}
+
+// NewEnclosedEnvironment creates a scope inside outer, sharing its runtime
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: outer, runtime: outer.runtime}
 }
@@ -0,0 +1,209 @@
+package object
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// EvictionPolicy decides which cached result is dropped when a pure function
+// cache is full
+type EvictionPolicy int
+
+const (
+	// LRU evicts the least recently used result
+	LRU EvictionPolicy = iota
+	// LFU evicts the least frequently used result, and the least recently
+	// used one among those used equally often
+	LFU
+)
+
+func (p EvictionPolicy) String() string {
+	if p == LFU {
+		return "lfu"
+	}
+	return "lru"
+}
+
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "lru":
+		return LRU, nil
+	case "lfu":
+		return LFU, nil
+	default:
+		return LRU, fmt.Errorf("unknown eviction policy %q, want lru or lfu", name)
+	}
+}
+
+// CacheStats counts how well a pure function cache is doing
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+type memoEntry struct {
+	sig     *memoSignature
+	key     string
+	val     Object
+	uses    int64
+	lastUse uint64
+	index   int
+}
+
+func (e *memoEntry) touch(registry *cacheRegistry) {
+	registry.clock++
+	e.lastUse = registry.clock
+	e.uses++
+}
+
+func colder(a, b *memoEntry, policy EvictionPolicy) bool {
+	if policy == LFU && a.uses != b.uses {
+		return a.uses < b.uses
+	}
+	return a.lastUse < b.lastUse
+}
+
+// entryHeap keeps the next result to evict on top
+type entryHeap struct {
+	entries []*memoEntry
+	policy  EvictionPolicy
+}
+
+func (h *entryHeap) Len() int           { return len(h.entries) }
+func (h *entryHeap) Less(i, j int) bool { return colder(h.entries[i], h.entries[j], h.policy) }
+func (h *entryHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].index = i
+	h.entries[j].index = j
+}
+func (h *entryHeap) Push(x interface{}) {
+	entry := x.(*memoEntry)
+	entry.index = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+func (h *entryHeap) Pop() interface{} {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
+
+// cacheRegistry bounds the number of results cached by all the pure
+// functions of a runtime together
+type cacheRegistry struct {
+	// clock orders uses of cached results across the caches, so that the
+	// limit can compare results of different functions
+	clock  uint64
+	limit  int
+	policy EvictionPolicy
+	size   int
+	// live holds the caches counted towards the limit. Caches are only
+	// tracked while a limit is set, since the registry keeps them alive.
+	live map[*PureFunctionCache]bool
+}
+
+// SetCacheLimit bounds the number of results cached by all pure functions of
+// the runtime together. Results cached before a limit was set don't count
+// towards it, so it should be set before running a program. A limit of 0
+// means unbounded.
+func (rt *Runtime) SetCacheLimit(limit int, policy EvictionPolicy) {
+	r := &rt.caches
+	r.limit = limit
+	r.policy = policy
+	if limit <= 0 {
+		r.size = 0
+		r.live = nil
+		return
+	}
+	r.evict(0)
+}
+
+// CacheLimit returns the limit set by SetCacheLimit
+func (rt *Runtime) CacheLimit() (int, EvictionPolicy) { return rt.caches.limit, rt.caches.policy }
+
+func (r *cacheRegistry) track(c *PureFunctionCache) {
+	if r.limit <= 0 {
+		return
+	}
+	if r.live == nil {
+		r.live = make(map[*PureFunctionCache]bool)
+	}
+	if !r.live[c] {
+		r.live[c] = true
+		// results cached before the cache was tracked count from now on
+		r.size += c.Len() - 1
+	}
+	r.size++
+}
+
+func (r *cacheRegistry) untrack(c *PureFunctionCache) {
+	if !r.live[c] {
+		return
+	}
+	r.size--
+	if c.Len() == 0 {
+		delete(r.live, c)
+	}
+}
+
+// evict evicts results until room more results fit within the limit. The
+// victim is the coldest of the next victims of each cache, compared using
+// the registry's policy.
+func (r *cacheRegistry) evict(room int) {
+	for r.limit > 0 && r.size+room > r.limit {
+		var victim *PureFunctionCache
+		for c := range r.live {
+			if victim == nil || colder(c.entries.entries[0], victim.entries.entries[0], r.policy) {
+				victim = c
+			}
+		}
+		if victim == nil {
+			return
+		}
+		victim.evictEntry(victim.entries.entries[0])
+	}
+}
+
+// SetLimit bounds the number of results in the cache. A limit of 0 means
+// unbounded.
+func (c *PureFunctionCache) SetLimit(limit int, policy EvictionPolicy) {
+	c.limit = limit
+	c.entries.policy = policy
+	heap.Init(&c.entries)
+	c.evict(0)
+}
+
+// Limit returns the limit set by SetLimit
+func (c *PureFunctionCache) Limit() (int, EvictionPolicy) { return c.limit, c.entries.policy }
+
+// Stats returns the hits, misses and evictions of the cache so far
+func (c *PureFunctionCache) Stats() CacheStats { return c.stats }
+
+// Clear drops every cached result. The stats are kept, and results persisted
+// to disk are not touched.
+func (c *PureFunctionCache) Clear() {
+	for c.entries.Len() > 0 {
+		c.remove(c.entries.entries[0])
+	}
+}
+
+// evict evicts results until room more results fit within the limit
+func (c *PureFunctionCache) evict(room int) {
+	for c.limit > 0 && c.entries.Len() > 0 && c.entries.Len()+room > c.limit {
+		c.evictEntry(c.entries.entries[0])
+	}
+}
+
+func (c *PureFunctionCache) evictEntry(entry *memoEntry) {
+	c.remove(entry)
+	c.stats.Evictions++
+}
+
+func (c *PureFunctionCache) remove(entry *memoEntry) {
+	heap.Remove(&c.entries, entry.index)
+	delete(entry.sig.results, entry.key)
+	if len(entry.sig.results) == 0 {
+		c.dropSignature(entry.sig)
+	}
+	c.registry.untrack(c)
+}
@@ -0,0 +1,157 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GraphDiff describes how the dependency graph of a value changed between
+// two runs. Nodes of the two graphs are aligned by the kind of syntax node
+// which created them and where it is in the source, so a node changes when
+// the same expression produced a different value.
+type GraphDiff struct {
+	Added        []GraphNode      `json:"added"`
+	Removed      []GraphNode      `json:"removed"`
+	Changed      []GraphNodeDiff  `json:"changed"`
+	AddedEdges   []GraphEdgeNodes `json:"added_edges"`
+	RemovedEdges []GraphEdgeNodes `json:"removed_edges"`
+}
+
+// GraphNodeDiff is a node which holds a different value in the new graph
+type GraphNodeDiff struct {
+	Old GraphNode `json:"old"`
+	New GraphNode `json:"new"`
+}
+
+// GraphEdgeNodes is an edge given by the nodes at its ends rather than ids,
+// since ids of the two graphs differ
+type GraphEdgeNodes struct {
+	Object    GraphNode `json:"object"`
+	DependsOn GraphNode `json:"depends_on"`
+}
+
+// DiffDependencyGraphs compares the graph of a value from an old run with
+// the graph from a new run. When an expression created several values, e.g.
+// because it is in a function which was called several times, they are
+// aligned in the order the graphs list them.
+func DiffDependencyGraphs(old, new DependencyGraph) GraphDiff {
+	diff := GraphDiff{
+		Added:        []GraphNode{},
+		Removed:      []GraphNode{},
+		Changed:      []GraphNodeDiff{},
+		AddedEdges:   []GraphEdgeNodes{},
+		RemovedEdges: []GraphEdgeNodes{},
+	}
+	oldKeys, oldNodes := alignmentKeys(old)
+	newKeys, newNodes := alignmentKeys(new)
+
+	for _, node := range old.Nodes {
+		match, ok := newNodes[oldKeys[node.ID]]
+		if !ok {
+			diff.Removed = append(diff.Removed, node)
+		} else if match.Type != node.Type || match.Value != node.Value {
+			diff.Changed = append(diff.Changed, GraphNodeDiff{Old: node, New: match})
+		}
+	}
+	for _, node := range new.Nodes {
+		if _, ok := oldNodes[newKeys[node.ID]]; !ok {
+			diff.Added = append(diff.Added, node)
+		}
+	}
+
+	edgeKey := func(keys map[int]string, edge GraphEdge) string {
+		return keys[edge.Object] + " -> " + keys[edge.DependsOn]
+	}
+	oldEdges := make(map[string]bool)
+	for _, edge := range old.Edges {
+		oldEdges[edgeKey(oldKeys, edge)] = true
+	}
+	newEdges := make(map[string]bool)
+	for _, edge := range new.Edges {
+		newEdges[edgeKey(newKeys, edge)] = true
+		if !oldEdges[edgeKey(newKeys, edge)] {
+			diff.AddedEdges = append(diff.AddedEdges, GraphEdgeNodes{
+				Object:    new.Nodes[edge.Object],
+				DependsOn: new.Nodes[edge.DependsOn],
+			})
+		}
+	}
+	for _, edge := range old.Edges {
+		if !newEdges[edgeKey(oldKeys, edge)] {
+			diff.RemovedEdges = append(diff.RemovedEdges, GraphEdgeNodes{
+				Object:    old.Nodes[edge.Object],
+				DependsOn: old.Nodes[edge.DependsOn],
+			})
+		}
+	}
+	return diff
+}
+
+// alignmentKeys names every node of a graph by its creator and span,
+// numbering nodes which share both
+func alignmentKeys(graph DependencyGraph) (map[int]string, map[string]GraphNode) {
+	keys := make(map[int]string, len(graph.Nodes))
+	nodes := make(map[string]GraphNode, len(graph.Nodes))
+	counts := make(map[string]int)
+	for _, node := range graph.Nodes {
+		base := fmt.Sprintf("%s `%s`", node.Creator, node.Source)
+		if node.Span != nil {
+			base = fmt.Sprintf("%s %s:%d:%d", node.Creator, node.Span.File, node.Span.Line, node.Span.Pos)
+		}
+		key := fmt.Sprintf("%s #%d", base, counts[base])
+		counts[base]++
+		keys[node.ID] = key
+		nodes[key] = node
+	}
+	return keys, nodes
+}
+
+// Empty reports whether the two graphs were the same
+func (d GraphDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0
+}
+
+// String lists the differences one per line: `~` for changed values, `+`
+// and `-` for added and removed values, and `+ edge` and `- edge` for
+// dependencies which appeared or disappeared
+func (d GraphDiff) String() string {
+	var out strings.Builder
+	for _, change := range d.Changed {
+		fmt.Fprintf(&out, "~ %s: %s -> %s\n", graphNodeLocation(change.Old), change.Old.Value, change.New.Value)
+	}
+	for _, node := range d.Added {
+		fmt.Fprintf(&out, "+ %s\n", describeGraphNode(node))
+	}
+	for _, node := range d.Removed {
+		fmt.Fprintf(&out, "- %s\n", describeGraphNode(node))
+	}
+	for _, edge := range d.AddedEdges {
+		fmt.Fprintf(&out, "+ edge %s depends on %s\n", describeGraphNode(edge.Object), describeGraphNode(edge.DependsOn))
+	}
+	for _, edge := range d.RemovedEdges {
+		fmt.Fprintf(&out, "- edge %s depends on %s\n", describeGraphNode(edge.Object), describeGraphNode(edge.DependsOn))
+	}
+	return out.String()
+}
+
+func describeGraphNode(node GraphNode) string {
+	if location := graphNodeLocation(node); location != "" {
+		return node.Value + " " + location
+	}
+	return node.Value
+}
+
+func graphNodeLocation(node GraphNode) string {
+	location := ""
+	if node.Source != "" {
+		location = fmt.Sprintf("`%s`", node.Source)
+	}
+	if node.Span == nil {
+		return location
+	}
+	if node.Span.File != "" {
+		return fmt.Sprintf("%s at %s line %d, pos %d", location, node.Span.File, node.Span.Line, node.Span.Pos)
+	}
+	return fmt.Sprintf("%s at line %d, pos %d", location, node.Span.Line, node.Span.Pos)
+}
@@ -0,0 +1,179 @@
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+	"koko/ast"
+	"sort"
+	"strings"
+)
+
+// maxValuePreview is the number of characters of a value kept in a graph node
+const maxValuePreview = 80
+
+// DependencyGraph is the dependency graph of a value in a form which can be
+// exported as JSON. Node ids are assigned in breadth first order from the
+// value, visiting dependencies in a fixed order, so the same program always
+// exports the same document.
+type DependencyGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	ID      int        `json:"id"`
+	Type    ObjectType `json:"type"`
+	Value   string     `json:"value"`
+	Creator string     `json:"creator,omitempty"`
+	Source  string     `json:"source,omitempty"`
+	Span    *GraphSpan `json:"span,omitempty"`
+}
+
+type GraphSpan struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
+	Pos  int    `json:"pos"`
+}
+
+// GraphEdge says that the value of Object was computed from DependsOn
+type GraphEdge struct {
+	Object    int `json:"object"`
+	DependsOn int `json:"depends_on"`
+}
+
+// GetDependencyGraph collects every value result depends on. Offsets are
+// internal bookkeeping, so like in the DOT output they are collapsed into
+// the values they point at.
+func GetDependencyGraph(result Object) DependencyGraph {
+	graph, _ := GetDependencyGraphObjects(result)
+	return graph
+}
+
+// GetDependencyGraphObjects is GetDependencyGraph, also returning the value
+// of every node, indexed by its id
+func GetDependencyGraphObjects(result Object) (DependencyGraph, []Object) {
+	graph := DependencyGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	objects := []Object{}
+	ids := make(map[Object]int)
+	queue := []Object{result}
+	ids[result] = 0
+	for len(queue) > 0 {
+		head := queue[0]
+		queue = queue[1:]
+		graph.Nodes = append(graph.Nodes, newGraphNode(ids[head], head))
+		objects = append(objects, head)
+
+		links := getObservableDepsFromObj(head)
+		sortGraphObjects(links)
+		seen := make(map[int]bool)
+		for _, link := range links {
+			id, ok := ids[link]
+			if !ok {
+				id = len(ids)
+				ids[link] = id
+				queue = append(queue, link)
+			}
+			if !seen[id] {
+				seen[id] = true
+				graph.Edges = append(graph.Edges, GraphEdge{Object: ids[head], DependsOn: id})
+			}
+		}
+	}
+	return graph, objects
+}
+
+// GetDependencyGraphJSON exports the dependency graph of result as JSON
+func GetDependencyGraphJSON(result Object) (string, error) {
+	out, err := json.MarshalIndent(GetDependencyGraph(result), "", "  ")
+	return string(out), err
+}
+
+func newGraphNode(id int, obj Object) GraphNode {
+	node := GraphNode{ID: id, Type: obj.Type(), Value: previewValue(obj)}
+	creator := obj.GetCreatorNode()
+	if creator == nil {
+		return node
+	}
+	node.Creator = creatorKind(creator)
+	node.Source = creator.String()
+	if span := creator.Span(); !span.Empty() {
+		node.Span = &GraphSpan{File: span.File, Line: span.BeginLine, Pos: span.BeginPos}
+	}
+	return node
+}
+
+func previewValue(obj Object) string {
+	value := []rune(obj.Inspect())
+	if len(value) > maxValuePreview {
+		return string(value[:maxValuePreview]) + "..."
+	}
+	return string(value)
+}
+
+func creatorKind(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+// graphObjectKey is what dependencies are ordered by: the span of the
+// expression which created them, then the expression and the value
+type graphObjectKey struct {
+	line, pos int
+	file      string
+	creator   string
+	source    string
+	encoding  string
+}
+
+func newGraphObjectKey(obj Object) graphObjectKey {
+	key := graphObjectKey{encoding: Encode(obj)}
+	if creator := obj.GetCreatorNode(); creator != nil {
+		key.creator = creatorKind(creator)
+		key.source = creator.String()
+		if span := creator.Span(); !span.Empty() {
+			key.line, key.pos, key.file = span.BeginLine, span.BeginPos, span.File
+		}
+	}
+	return key
+}
+
+func (k graphObjectKey) less(o graphObjectKey) bool {
+	if k.line != o.line {
+		return k.line < o.line
+	}
+	if k.pos != o.pos {
+		return k.pos < o.pos
+	}
+	if k.file != o.file {
+		return k.file < o.file
+	}
+	if k.creator != o.creator {
+		return k.creator < o.creator
+	}
+	if k.source != o.source {
+		return k.source < o.source
+	}
+	return k.encoding < o.encoding
+}
+
+// sortGraphObjects orders the dependencies of a value by where they were
+// created and what they hold, since dependency links are kept in a map. The
+// keys are computed once up front, as encoding a value can be expensive.
+func sortGraphObjects(objs []Object) {
+	keys := make([]graphObjectKey, len(objs))
+	for i, obj := range objs {
+		keys[i] = newGraphObjectKey(obj)
+	}
+	sort.Stable(graphObjectsByKey{objs, keys})
+}
+
+type graphObjectsByKey struct {
+	objs []Object
+	keys []graphObjectKey
+}
+
+func (s graphObjectsByKey) Len() int           { return len(s.objs) }
+func (s graphObjectsByKey) Less(i, j int) bool { return s.keys[i].less(s.keys[j]) }
+func (s graphObjectsByKey) Swap(i, j int) {
+	s.objs[i], s.objs[j] = s.objs[j], s.objs[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
@@ -49,6 +49,17 @@ func getObservableDepsFromObj(obj Object) []Object {
 	return out
 }
 
+// dotNodeLabel names a value by the node which created it and where that
+// node is. Values without a creator node are named by their type and value.
+func dotNodeLabel(obj Object) string {
+	creator := obj.GetCreatorNode()
+	if creator == nil {
+		return fmt.Sprintf("%s %s", obj.Type(), previewValue(obj))
+	}
+	span := creator.Span()
+	return fmt.Sprintf("%s\n line: %d, pos: %d", creator.String(), span.BeginLine, span.BeginPos)
+}
+
 func GetAllDependenciesToDotLang(result Object) string {
 	seenNodes := make(map[Object]bool)
 	queue := []Object{}
@@ -67,13 +78,6 @@ func GetAllDependenciesToDotLang(result Object) string {
 		}
 		seenNodes[head] = true
 		for _, link := range getObservableDepsFromObj(head) {
-			// TODO (Peter lots of conditions here!!! Clean them up!)
-			if head.GetCreatorNode() == nil {
-				panic(fmt.Sprintf("Graph construction failed %+v\n", head))
-			}
-			if link.GetCreatorNode() == nil {
-				panic(fmt.Sprintf("Graph construction failed %+v\n", link))
-			}
 			// TODO (Peter) this really needs to be cleaner like very now
 			if _, ok := head.GetCreatorNode().(*ast.BuiltinValue); ok {
 				continue
@@ -87,15 +91,14 @@ func GetAllDependenciesToDotLang(result Object) string {
 			if _, ok := link.(*Offset); ok {
 				continue
 			}
-			if head.GetCreatorNode().String() == link.GetCreatorNode().String() {
+			if head.GetCreatorNode() != nil && link.GetCreatorNode() != nil &&
+				head.GetCreatorNode().String() == link.GetCreatorNode().String() {
 				// copied dependencies look like the node points to itself
 				// they are condensed in this representation
 				continue
 			}
-			headSpan := head.GetCreatorNode().Span()
-			linkSpan := link.GetCreatorNode().Span()
-			headNode := fmt.Sprintf("%s\n line: %d, pos: %d", head.GetCreatorNode().String(), headSpan.BeginLine, headSpan.BeginPos)
-			linkNode := fmt.Sprintf("%s\n line: %d, pos: %d", link.GetCreatorNode().String(), linkSpan.BeginLine, linkSpan.BeginPos)
+			headNode := dotNodeLabel(head)
+			linkNode := dotNodeLabel(link)
 			edge := fmt.Sprintf("\t\"%s\" -> \"%s\";\n", escapeStringForGraphviz(linkNode), escapeStringForGraphviz(headNode))
 			if _, ok := seenOutputEdges[edge]; !ok {
 				seenOutputEdges[edge] = true
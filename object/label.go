@@ -0,0 +1,98 @@
+package object
+
+import (
+	"fmt"
+	"koko/ast"
+	"sort"
+)
+
+// Label marks a value as coming from a particular kind of source, e.g.
+// "secret". Labeled values depend on their label, so everything computed
+// from them does too, and the labels of a value are found by walking its
+// dependency graph. Labels are never values of a program themselves.
+type Label struct {
+	Name         string
+	Dependencies map[Object]bool
+	ASTCreator   ast.Node
+}
+
+// NewLabel creates a label, noting that rt has labeled values
+func (rt *Runtime) NewLabel(name string) *Label {
+	rt.labeled = true
+	return &Label{Name: name}
+}
+
+func (l *Label) Type() ObjectType { return LABEL_OBJ }
+func (l *Label) Inspect() string  { return fmt.Sprintf("label(%s)", l.Name) }
+func (l *Label) String() String   { return String{Value: l.Inspect()} }
+func (l *Label) Copy() Object {
+	return &Label{Name: l.Name, Dependencies: map[Object]bool{l: true}, ASTCreator: l.ASTCreator}
+}
+func (l *Label) CopyWithoutDependency() Object {
+	return &Label{Name: l.Name, ASTCreator: l.ASTCreator}
+}
+func (l *Label) Equal(o Object) bool {
+	comp, ok := o.(*Label)
+	return ok && l.Name == comp.Name
+}
+func (l *Label) Falsey() Object { return NIL.Copy() }
+func (l *Label) AddDependency(dep Object) {
+	if l.Dependencies == nil {
+		l.Dependencies = make(map[Object]bool)
+	}
+	l.Dependencies[dep] = true
+}
+func (l *Label) GetDependencyLinks() map[Object]bool { return l.Dependencies }
+func (l *Label) GetCreatorNode() ast.Node            { return l.ASTCreator }
+func (l *Label) SetCreatorNode(node ast.Node)        { l.ASTCreator = node }
+
+// Labels returns the sorted names of the labels obj was computed from
+func (rt *Runtime) Labels(obj Object) []string {
+	if !rt.labeled {
+		return []string{}
+	}
+	names := make(map[string]bool)
+	for dep := range GetAllDependencies(obj) {
+		if label, ok := dep.(*Label); ok {
+			names[label.Name] = true
+		}
+	}
+	out := make([]string, 0, len(names))
+	for name := range names {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// AttachLabel returns a copy of obj depending on label. The elements of
+// arrays and values of hashes are labeled too, since reading them doesn't
+// depend on the collection they are in.
+func AttachLabel(obj Object, label *Label) Object {
+	switch obj := obj.(type) {
+	case *Array:
+		elements := make([]Object, 0, len(obj.Elements))
+		for _, el := range obj.Elements {
+			elements = append(elements, AttachLabel(el, label))
+		}
+		res := CreateArray(elements)
+		res.AddDependency(obj)
+		res.AddDependency(label)
+		res.AddLengthDependency(label)
+		return res
+	case *Hash:
+		pairs := make(map[HashKey]HashPair, len(obj.Pairs))
+		for k, pair := range obj.Pairs {
+			pairs[k] = HashPair{Key: pair.Key, Value: AttachLabel(pair.Value, label)}
+		}
+		res := CreateHash(pairs)
+		res.AddDependency(obj)
+		res.AddDependency(label)
+		res.AddLengthDependency(label)
+		return res
+	default:
+		res := obj.Copy()
+		res.AddDependency(label)
+		return res
+	}
+}
@@ -0,0 +1,369 @@
+package object
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DependencyPath addresses a sub-part of the arguments of a function call,
+// e.g. the whole first argument ("0"), the third element of the first
+// argument ("0|2"), the "steve" value of a hash argument ("1|@steve") or the
+// length of an argument ("0#"). The length of a hash stands for its keys.
+type DependencyPath struct {
+	Arg    int
+	Steps  []PathStep
+	Length bool
+}
+
+// PathStep is a single step into an array (by Index) or a hash (by Key)
+type PathStep struct {
+	Index int64
+	Key   Object
+}
+
+func (s PathStep) String() string {
+	if s.Key != nil {
+		return "@" + s.Key.Inspect()
+	}
+	return fmt.Sprint(s.Index)
+}
+
+// Encode is like String, but unambiguous
+func (s PathStep) Encode() string {
+	if s.Key != nil {
+		return "k" + Encode(s.Key)
+	}
+	return "i" + fmt.Sprint(s.Index) + ";"
+}
+
+func (p DependencyPath) String() string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprint(p.Arg))
+	for _, step := range p.Steps {
+		out.WriteString("|" + step.String())
+	}
+	if p.Length {
+		out.WriteString("#")
+	}
+	return out.String()
+}
+
+// Encode is like String, but unambiguous
+func (p DependencyPath) Encode() string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprint(p.Arg) + ";")
+	for _, step := range p.Steps {
+		out.WriteString(step.Encode())
+	}
+	if p.Length {
+		out.WriteString("#")
+	}
+	return out.String()
+}
+
+// Resolve returns the object found at the path in args, if there is one
+func (p DependencyPath) Resolve(args []Object) (Object, bool) {
+	if p.Arg < 0 || p.Arg >= len(args) {
+		return nil, false
+	}
+	obj := args[p.Arg]
+	for _, step := range p.Steps {
+		switch container := obj.(type) {
+		case *Array:
+			if step.Key != nil || step.Index < 0 || step.Index >= int64(len(container.Elements)) {
+				return nil, false
+			}
+			obj = container.Elements[step.Index]
+		case *Hash:
+			key, ok := step.Key.(Hashable)
+			if !ok {
+				return nil, false
+			}
+			pair, ok := container.Pairs[key.HashKey()]
+			if !ok {
+				return nil, false
+			}
+			obj = pair.Value
+		default:
+			return nil, false
+		}
+	}
+	if p.Length {
+		switch container := obj.(type) {
+		case *Array:
+			return &container.Length, true
+		case *Hash:
+			return &container.Length, true
+		default:
+			return nil, false
+		}
+	}
+	return obj, true
+}
+
+// covers reports whether the path p already accounts for everything at other
+func (p DependencyPath) covers(other DependencyPath) bool {
+	if p.Length || p.Arg != other.Arg || len(p.Steps) > len(other.Steps) {
+		return false
+	}
+	for i, step := range p.Steps {
+		if step.Encode() != other.Steps[i].Encode() {
+			return false
+		}
+	}
+	return true
+}
+
+// CollectDependencyPaths lists every sub-part of args which appears in the
+// dependency trace of a result. The paths are sorted by their string form.
+func CollectDependencyPaths(args []Object, trace map[Object]bool) []DependencyPath {
+	out := []DependencyPath{}
+	for i, arg := range args {
+		collectDependencyPaths(arg, trace, DependencyPath{Arg: i}, &out)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].String() < out[j].String() })
+	return out
+}
+
+func collectDependencyPaths(obj Object, trace map[Object]bool, path DependencyPath, out *[]DependencyPath) {
+	if trace[obj] {
+		*out = append(*out, path)
+	}
+	switch container := obj.(type) {
+	case *Array:
+		if trace[&container.Length] {
+			*out = append(*out, DependencyPath{Arg: path.Arg, Steps: path.Steps, Length: true})
+		}
+		for i, el := range container.Elements {
+			collectDependencyPaths(el, trace, path.child(PathStep{Index: int64(i)}), out)
+		}
+	case *Hash:
+		if trace[&container.Length] {
+			*out = append(*out, DependencyPath{Arg: path.Arg, Steps: path.Steps, Length: true})
+		}
+		for _, pair := range container.Pairs {
+			collectDependencyPaths(pair.Value, trace, path.child(PathStep{Key: pair.Key}), out)
+		}
+	}
+}
+
+func (p DependencyPath) child(step PathStep) DependencyPath {
+	steps := make([]PathStep, len(p.Steps), len(p.Steps)+1)
+	copy(steps, p.Steps)
+	return DependencyPath{Arg: p.Arg, Steps: append(steps, step)}
+}
+
+// minimalPaths drops the paths which are already covered by another path,
+// e.g. "0|2" is redundant when the whole of argument "0" is a dependency
+func minimalPaths(paths []DependencyPath) []DependencyPath {
+	out := []DependencyPath{}
+	for i, p := range paths {
+		redundant := false
+		for j, other := range paths {
+			if i != j && other.covers(p) && !(p.covers(other) && j > i) {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// A memoSignature groups the cached results of calls whose results depended
+// on the same set of argument sub-parts. Results are keyed by the values
+// found at those sub-parts.
+type memoSignature struct {
+	name    string
+	paths   []DependencyPath
+	results map[string]*memoEntry
+}
+
+// resolve finds the values at the signature's paths in args. Missing
+// sub-parts are left as nil.
+func (s *memoSignature) resolve(args []Object) []Object {
+	values := make([]Object, 0, len(s.paths))
+	for _, p := range s.paths {
+		if val, ok := p.Resolve(args); ok {
+			values = append(values, keysFor(p, val, args))
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values
+}
+
+// keysFor replaces the length of a hash with its keys, since hashes of the
+// same length can have different keys. The keys depend on the length, so
+// results found by them still do.
+func keysFor(p DependencyPath, val Object, args []Object) Object {
+	if !p.Length {
+		return val
+	}
+	container, _ := DependencyPath{Arg: p.Arg, Steps: p.Steps}.Resolve(args)
+	hash, ok := container.(*Hash)
+	if !ok {
+		return val
+	}
+	keys := make([]Object, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		keys = append(keys, pair.Key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return Encode(keys[i]) < Encode(keys[j]) })
+	res := CreateArray(keys)
+	res.AddDependency(val)
+	return res
+}
+
+func memoKey(values []Object) (string, []Object) {
+	var key strings.Builder
+	deps := make([]Object, 0, len(values))
+	for _, val := range values {
+		// a missing sub-part is encoded as nil, distinctly from any value
+		key.WriteString(Encode(val))
+		if val != nil {
+			deps = append(deps, val)
+		}
+	}
+	return key.String(), deps
+}
+
+// PureFunctionCache memoizes the results of a pure function. Every entry
+// records which argument sub-parts its result depended on, so a call hits
+// the cache whenever those sub-parts match, whatever the rest of the
+// arguments look like.
+//
+// The cache is unbounded unless a limit is set, in which case results are
+// evicted according to its EvictionPolicy.
+type PureFunctionCache struct {
+	signatures map[string]*memoSignature
+	order      []*memoSignature
+	entries    entryHeap
+	limit      int
+	stats      CacheStats
+	store      *persistentStore
+	registry   *cacheRegistry
+	// the values the function captured when the results were computed, and
+	// their fingerprint
+	captured    []Object
+	fingerprint string
+}
+
+// NewPureFunctionCache creates a cache counted towards the limit of rt
+func NewPureFunctionCache(rt *Runtime) *PureFunctionCache {
+	return &PureFunctionCache{signatures: make(map[string]*memoSignature), registry: &rt.caches}
+}
+
+// Get returns the cached result for args, along with the argument sub-parts
+// the result depends on
+func (c *PureFunctionCache) Get(args []Object) (Object, []Object, bool) {
+	for _, sig := range c.order {
+		key, deps := memoKey(sig.resolve(args))
+		if entry, ok := sig.results[key]; ok {
+			c.stats.Hits++
+			entry.touch(c.registry)
+			heap.Fix(&c.entries, entry.index)
+			return entry.val, deps, true
+		}
+	}
+	c.stats.Misses++
+	return nil, nil, false
+}
+
+// Set caches val as the result for every call whose args match these args
+// at the given paths
+func (c *PureFunctionCache) Set(args []Object, paths []DependencyPath, val Object) Object {
+	paths = minimalPaths(paths)
+	sig := c.signature(paths)
+	values := sig.resolve(args)
+	c.set(sig, values, val)
+	if c.store != nil {
+		c.store.write(sig.paths, values, val)
+	}
+	return val
+}
+
+func (c *PureFunctionCache) set(sig *memoSignature, values []Object, val Object) {
+	key, _ := memoKey(values)
+	if entry, ok := sig.results[key]; ok {
+		entry.val = val
+		entry.touch(c.registry)
+		heap.Fix(&c.entries, entry.index)
+		return
+	}
+	// room is made before adding the result, otherwise a new result could be
+	// its own victim
+	c.evict(1)
+	c.registry.evict(1)
+	if c.signatures[sig.name] != sig {
+		// making room dropped the signature along with its last result
+		c.signatures[sig.name] = sig
+		c.order = append(c.order, sig)
+	}
+
+	entry := &memoEntry{sig: sig, key: key, val: val}
+	entry.touch(c.registry)
+	sig.results[key] = entry
+	heap.Push(&c.entries, entry)
+	c.registry.track(c)
+	// results cached before the cache was tracked can push it over the limit
+	c.registry.evict(0)
+}
+
+func (c *PureFunctionCache) signature(paths []DependencyPath) *memoSignature {
+	names := make([]string, 0, len(paths))
+	for _, p := range paths {
+		names = append(names, p.Encode())
+	}
+	sigName := strings.Join(names, ",")
+	sig, ok := c.signatures[sigName]
+	if !ok {
+		sig = &memoSignature{name: sigName, paths: paths, results: make(map[string]*memoEntry)}
+		c.signatures[sigName] = sig
+		c.order = append(c.order, sig)
+	}
+	return sig
+}
+
+// dropSignature forgets a signature once all of its results are gone, so
+// lookups don't keep trying it
+func (c *PureFunctionCache) dropSignature(sig *memoSignature) {
+	delete(c.signatures, sig.name)
+	for i, other := range c.order {
+		if other == sig {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Captured returns the values the function captured when the results were
+// computed, and whether it captured any yet. Values don't change in place, so
+// the results still hold while the function captures the same objects.
+func (c *PureFunctionCache) Captured() ([]Object, bool) {
+	return c.captured, c.fingerprint != ""
+}
+
+// Recapture records the values the function captures now, identified by
+// fingerprint. When the fingerprint differs from that of the values the
+// results were computed with, the results are dropped and no longer written
+// to the file they were persisted in. It reports whether they were.
+func (c *PureFunctionCache) Recapture(captured []Object, fingerprint string) bool {
+	c.captured = captured
+	if fingerprint == c.fingerprint {
+		return false
+	}
+	c.fingerprint = fingerprint
+	c.store = nil
+	c.Clear()
+	return true
+}
+
+// Len returns the number of cached results
+func (c *PureFunctionCache) Len() int {
+	return c.entries.Len()
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"koko/ast"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -12,19 +13,21 @@ import (
 type ObjectType string
 
 const (
-	BOOLEAN_OBJ              = "BOOLEAN"
-	FLOAT_OBJ                = "FLOAT"
-	INTEGER_OBJ              = "INTEGER"
-	NIL_OBJ                  = "NIL"
-	RETURN_OBJ               = "RETURN"
-	STRING_OBJ               = "STRING"
-	ERROR_OBJ                = "ERROR"
-	FUNCTION_OBJ             = "FUNCTION"
-	BUILTIN_OBJ              = "BUILTIN"
-	ARRAY_OBJ                = "ARRAY"
-	TRACE_OBJ                = "TRACE"
-	HASH_OBJ                 = "HASH"
-	DEBUG_TRACE_METADATA_OBJ = "DEBUG_TRACE_METADATA"
+	BOOLEAN_OBJ  = "BOOLEAN"
+	FLOAT_OBJ    = "FLOAT"
+	INTEGER_OBJ  = "INTEGER"
+	NIL_OBJ      = "NIL"
+	RETURN_OBJ   = "RETURN"
+	STRING_OBJ   = "STRING"
+	ERROR_OBJ    = "ERROR"
+	FUNCTION_OBJ = "FUNCTION"
+	BUILTIN_OBJ  = "BUILTIN"
+	ARRAY_OBJ    = "ARRAY"
+	TRACE_OBJ    = "TRACE"
+	HASH_OBJ     = "HASH"
+	LABEL_OBJ    = "LABEL"
+	BREAK_OBJ    = "BREAK"
+	CONTINUE_OBJ = "CONTINUE"
 )
 
 var (
@@ -273,6 +276,63 @@ func (r *Return) GetDependencyLinks() map[Object]bool { return r.Dependencies }
 func (r *Return) GetCreatorNode() ast.Node            { return r.ASTCreator }
 func (r *Return) SetCreatorNode(node ast.Node)        { r.ASTCreator = node }
 
+// Break and Continue are what break and continue statements evaluate to.
+// Like Return, they stop the blocks they are in, until the loop around
+// them handles them.
+type Break struct {
+	Dependencies map[Object]bool
+	ASTCreator   ast.Node
+}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+func (b *Break) String() String   { return String{Value: b.Inspect()} }
+func (b *Break) Copy() Object {
+	return &Break{Dependencies: map[Object]bool{b: true}, ASTCreator: b.ASTCreator}
+}
+func (b *Break) CopyWithoutDependency() Object { return &Break{ASTCreator: b.ASTCreator} }
+func (b *Break) Equal(o Object) bool {
+	_, ok := o.(*Break)
+	return ok
+}
+func (b *Break) Falsey() Object { return NIL.Copy() }
+func (b *Break) AddDependency(dep Object) {
+	if b.Dependencies == nil {
+		b.Dependencies = make(map[Object]bool)
+	}
+	b.Dependencies[dep] = true
+}
+func (b *Break) GetDependencyLinks() map[Object]bool { return b.Dependencies }
+func (b *Break) GetCreatorNode() ast.Node            { return b.ASTCreator }
+func (b *Break) SetCreatorNode(node ast.Node)        { b.ASTCreator = node }
+
+type Continue struct {
+	Dependencies map[Object]bool
+	ASTCreator   ast.Node
+}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+func (c *Continue) String() String   { return String{Value: c.Inspect()} }
+func (c *Continue) Copy() Object {
+	return &Continue{Dependencies: map[Object]bool{c: true}, ASTCreator: c.ASTCreator}
+}
+func (c *Continue) CopyWithoutDependency() Object { return &Continue{ASTCreator: c.ASTCreator} }
+func (c *Continue) Equal(o Object) bool {
+	_, ok := o.(*Continue)
+	return ok
+}
+func (c *Continue) Falsey() Object { return NIL.Copy() }
+func (c *Continue) AddDependency(dep Object) {
+	if c.Dependencies == nil {
+		c.Dependencies = make(map[Object]bool)
+	}
+	c.Dependencies[dep] = true
+}
+func (c *Continue) GetDependencyLinks() map[Object]bool { return c.Dependencies }
+func (c *Continue) GetCreatorNode() ast.Node            { return c.ASTCreator }
+func (c *Continue) SetCreatorNode(node ast.Node)        { c.ASTCreator = node }
+
 type Nil struct {
 	Dependencies map[Object]bool
 	ASTCreator   ast.Node
@@ -338,9 +398,15 @@ func (e *Error) GetCreatorNode() ast.Node            { return e.ASTCreator }
 func (e *Error) SetCreatorNode(node ast.Node)        { e.ASTCreator = node }
 
 type Function struct {
-	Parameters   []*ast.Identifier
-	Body         *ast.BlockStatement
-	Env          *Environment
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	// FreeNames are the names the body uses without binding them, once a
+	// pure function calling this one needed them
+	FreeNames []string
+	// Checked is set on functions created while a pure function ran. The
+	// purity of the code creating them was checked, which covers theirs.
+	Checked      bool
 	Dependencies map[Object]bool
 	ASTCreator   ast.Node
 }
@@ -365,10 +431,10 @@ func (f *Function) Inspect() string {
 }
 func (f *Function) String() String { return String{Value: f.Inspect()} }
 func (f *Function) Copy() Object {
-	return &Function{Parameters: f.Parameters, Body: f.Body, Env: f.Env, Dependencies: map[Object]bool{f: true}, ASTCreator: f.ASTCreator}
+	return &Function{Parameters: f.Parameters, Body: f.Body, Env: f.Env, FreeNames: f.FreeNames, Checked: f.Checked, Dependencies: map[Object]bool{f: true}, ASTCreator: f.ASTCreator}
 }
 func (f *Function) CopyWithoutDependency() Object {
-	return &Function{Parameters: f.Parameters, Body: f.Body, Env: f.Env, ASTCreator: f.ASTCreator}
+	return &Function{Parameters: f.Parameters, Body: f.Body, Env: f.Env, FreeNames: f.FreeNames, Checked: f.Checked, ASTCreator: f.ASTCreator}
 }
 
 // JEM: Could properly implement function comparison
@@ -388,10 +454,13 @@ func (f *Function) GetDependencyLinks() map[Object]bool { return f.Dependencies
 func (f *Function) GetCreatorNode() ast.Node            { return f.ASTCreator }
 func (f *Function) SetCreatorNode(node ast.Node)        { f.ASTCreator = node }
 
-type BuiltinFunction func(args ...Object) Object
+type BuiltinFunction func(rt *Runtime, args ...Object) Object
 
 type Builtin struct {
-	Fn           BuiltinFunction
+	Fn BuiltinFunction
+	// Pure builtins have no side effects and always return the same result
+	// for the same arguments, so pure functions are allowed to call them
+	Pure         bool
 	Dependencies map[Object]bool
 	ASTCreator   ast.Node
 }
@@ -400,10 +469,10 @@ func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 func (b *Builtin) String() String   { return String{Value: b.Inspect()} }
 func (b *Builtin) Copy() Object {
-	return &Builtin{Fn: b.Fn, Dependencies: map[Object]bool{b: true}, ASTCreator: b.ASTCreator}
+	return &Builtin{Fn: b.Fn, Pure: b.Pure, Dependencies: map[Object]bool{b: true}, ASTCreator: b.ASTCreator}
 }
 func (b *Builtin) CopyWithoutDependency() Object {
-	return &Builtin{Fn: b.Fn, ASTCreator: b.ASTCreator}
+	return &Builtin{Fn: b.Fn, Pure: b.Pure, ASTCreator: b.ASTCreator}
 }
 
 // JEM: Could properly implement builtin comparison
@@ -502,21 +571,26 @@ func (a *Array) GetCreatorNode() ast.Node { return a.ASTCreator }
 func (a *Array) SetCreatorNode(node ast.Node) {
 	a.ASTCreator = node
 	a.Length.ASTCreator = &ast.LengthNode{Child: node}
-	a.Offset.ASTCreator = &ast.BuiltinValue{}
+	a.Offset.ASTCreator = node
 }
 
 type PureFunction struct {
-	Parameters   []*ast.Identifier
-	Body         *ast.BlockStatement
-	Env          *Environment
-	Cache        map[string]Object
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	Cache      *PureFunctionCache
+	// Unresolved is set while the body uses names which weren't bound when
+	// its purity was checked, so that it is checked again before each call
+	Unresolved bool
+	// FreeNames are the names the body uses without binding them, whose
+	// values the cached results were computed with
+	FreeNames    []string
 	Dependencies map[Object]bool
 	ASTCreator   ast.Node
 }
 
 func NewPureFunction(parameters []*ast.Identifier, env *Environment, body *ast.BlockStatement) *PureFunction {
-	cache := make(map[string]Object)
-	return &PureFunction{Parameters: parameters, Body: body, Env: env, Cache: cache}
+	return &PureFunction{Parameters: parameters, Body: body, Env: env, Cache: NewPureFunctionCache(env.Runtime())}
 }
 
 func (f *PureFunction) Type() ObjectType { return FUNCTION_OBJ }
@@ -538,22 +612,20 @@ func (f *PureFunction) Inspect() string {
 	return out.String()
 }
 func (f *PureFunction) String() String { return String{Value: f.Inspect()} }
-func (f *PureFunction) Get(args []Object) (Object, bool) {
-	obj, ok := f.Cache[objectsToString(args)]
-	return obj, ok
+func (f *PureFunction) Get(args []Object) (Object, []Object, bool) {
+	return f.Cache.Get(args)
 }
 func (f *PureFunction) Falsey() Object { return NIL.Copy() }
 
-func (f *PureFunction) Set(args []Object, val Object) Object {
-	f.Cache[objectsToString(args)] = val
-	return val
+func (f *PureFunction) Set(args []Object, paths []DependencyPath, val Object) Object {
+	return f.Cache.Set(args, paths, val)
 }
 func (f *PureFunction) Copy() Object {
-	return &PureFunction{Parameters: f.Parameters, Body: f.Body, Cache: f.Cache, Env: f.Env, Dependencies: map[Object]bool{f: true}, ASTCreator: f.ASTCreator}
+	return &PureFunction{Parameters: f.Parameters, Body: f.Body, Cache: f.Cache, Env: f.Env, Unresolved: f.Unresolved, FreeNames: f.FreeNames, Dependencies: map[Object]bool{f: true}, ASTCreator: f.ASTCreator}
 }
 
 func (f *PureFunction) CopyWithoutDependency() Object {
-	return &PureFunction{Parameters: f.Parameters, Body: f.Body, Cache: f.Cache, Env: f.Env, ASTCreator: f.ASTCreator}
+	return &PureFunction{Parameters: f.Parameters, Body: f.Body, Cache: f.Cache, Env: f.Env, Unresolved: f.Unresolved, FreeNames: f.FreeNames, ASTCreator: f.ASTCreator}
 }
 
 func (f *PureFunction) GetCreatorNode() ast.Node     { return f.ASTCreator }
@@ -574,14 +646,6 @@ func (f *PureFunction) Equal(o Object) bool {
 
 func (f *PureFunction) GetDependencyLinks() map[Object]bool { return f.Dependencies }
 
-func objectsToString(args []Object) string {
-	var res string
-	for _, arg := range args {
-		res += "@" + arg.String().Value
-	}
-	return res
-}
-
 type HashPair struct {
 	Key   Object
 	Value Object
@@ -661,8 +725,11 @@ func (h *Hash) GetDependencyLinks() map[Object]bool {
 	return out
 }
 
-func (h *Hash) GetCreatorNode() ast.Node     { return h.ASTCreator }
-func (h *Hash) SetCreatorNode(node ast.Node) { h.ASTCreator = node }
+func (h *Hash) GetCreatorNode() ast.Node { return h.ASTCreator }
+func (h *Hash) SetCreatorNode(node ast.Node) {
+	h.ASTCreator = node
+	h.Offset.ASTCreator = node
+}
 
 type HashKey struct {
 	Type  ObjectType
@@ -673,6 +740,8 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
+// Offset stands for where an array or hash is, which values indexed out of
+// it depend on. Its creator is the expression which created the container.
 type Offset struct {
 	Dependencies map[Object]bool
 	ASTCreator   ast.Node
@@ -706,38 +775,73 @@ func (o *Offset) GetDependencyLinks() map[Object]bool { return o.Dependencies }
 func (o *Offset) GetCreatorNode() ast.Node            { return o.ASTCreator }
 func (o *Offset) SetCreatorNode(node ast.Node)        { o.ASTCreator = node }
 
-type DebugTraceMetadata struct {
-	DebugMetadata map[string]bool
-	Dependencies  map[Object]bool
-	ASTCreator    ast.Node
+// Trace is the result of a traced call: the value the call returned and the
+// argument sub-parts it depended on, as dependency path strings like "0|2"
+type Trace struct {
+	Result       Object
+	Deps         []string
+	Dependencies map[Object]bool
+	ASTCreator   ast.Node
+}
+
+// NewTrace creates a trace of result, keeping its deps sorted so that traces
+// print and compare the same however the deps were collected
+func NewTrace(result Object, deps []string) *Trace {
+	sorted := make([]string, len(deps))
+	copy(sorted, deps)
+	sort.Strings(sorted)
+	return &Trace{Result: result, Deps: sorted}
 }
 
-// NOTE this object is techincal debt
-// TODO (Peter) remove this gracefully and replace with a better version
-func (d *DebugTraceMetadata) Type() ObjectType { return DEBUG_TRACE_METADATA_OBJ }
-func (d *DebugTraceMetadata) Inspect() string  { return fmt.Sprintf("%+v\n", d.DebugMetadata) }
-func (d *DebugTraceMetadata) String() String   { return String{Value: d.Inspect()} }
-func (d *DebugTraceMetadata) Copy() Object {
-	return &DebugTraceMetadata{DebugMetadata: d.DebugMetadata, Dependencies: map[Object]bool{d: true}, ASTCreator: d.ASTCreator}
+func (t *Trace) Type() ObjectType { return TRACE_OBJ }
+func (t *Trace) Inspect() string {
+	deps := make([]string, 0, len(t.Deps))
+	for _, d := range t.Deps {
+		deps = append(deps, strconv.Quote(d))
+	}
+	return fmt.Sprintf("trace(%s, [%s])", t.Result.Inspect(), strings.Join(deps, ", "))
+}
+func (t *Trace) String() String { return String{Value: t.Inspect()} }
+func (t *Trace) Copy() Object {
+	return &Trace{Result: t.Result, Deps: t.Deps, Dependencies: map[Object]bool{t: true}, ASTCreator: t.ASTCreator}
 }
-func (d *DebugTraceMetadata) CopyWithoutDependency() Object {
-	return &DebugTraceMetadata{DebugMetadata: d.DebugMetadata, ASTCreator: d.ASTCreator}
+func (t *Trace) CopyWithoutDependency() Object {
+	return &Trace{Result: t.Result, Deps: t.Deps, ASTCreator: t.ASTCreator}
 }
+func (t *Trace) Equal(o Object) bool {
+	comp, ok := o.(*Trace)
+	if !ok || len(t.Deps) != len(comp.Deps) || !t.Result.Equal(comp.Result) {
+		return false
+	}
+	for i, d := range t.Deps {
+		if d != comp.Deps[i] {
+			return false
+		}
+	}
+	return true
+}
+func (t *Trace) Falsey() Object { return NIL.Copy() }
 
-// JEM: Could properly implement builtin comparison
-func (d *DebugTraceMetadata) Equal(o Object) bool {
-	_, ok := o.(*Builtin)
-	return ok && false
+// DepsArray returns the deps of the trace as an array of strings
+func (t *Trace) DepsArray() *Array {
+	elements := make([]Object, 0, len(t.Deps))
+	for _, d := range t.Deps {
+		el := &String{Value: d}
+		el.AddDependency(t)
+		elements = append(elements, el)
+	}
+	res := CreateArray(elements)
+	res.AddLengthDependency(t)
+	return res
 }
-func (d *DebugTraceMetadata) Falsey() Object { return NIL.Copy() }
 
-func (d *DebugTraceMetadata) AddDependency(dep Object) {
-	if d.Dependencies == nil {
-		d.Dependencies = make(map[Object]bool)
+func (t *Trace) AddDependency(dep Object) {
+	if t.Dependencies == nil {
+		t.Dependencies = make(map[Object]bool)
 	}
-	d.Dependencies[dep] = true
+	t.Dependencies[dep] = true
 }
-func (d *DebugTraceMetadata) GetDependencyLinks() map[Object]bool { return d.Dependencies }
+func (t *Trace) GetDependencyLinks() map[Object]bool { return t.Dependencies }
 
-func (d *DebugTraceMetadata) GetCreatorNode() ast.Node     { return d.ASTCreator }
-func (d *DebugTraceMetadata) SetCreatorNode(node ast.Node) { d.ASTCreator = node }
+func (t *Trace) GetCreatorNode() ast.Node     { return t.ASTCreator }
+func (t *Trace) SetCreatorNode(node ast.Node) { t.ASTCreator = node }
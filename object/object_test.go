@@ -1,6 +1,11 @@
 package object
 
-import "testing"
+import (
+	"koko/ast"
+	"koko/token"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +25,247 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have different hash keys")
 	}
 }
+
+func TestEncodeIsTypeTagged(t *testing.T) {
+	one := &Integer{Value: 1}
+	oneString := &String{Value: "1"}
+	if Encode(one) == Encode(oneString) {
+		t.Errorf("integer and string with the same text have the same encoding")
+	}
+
+	joined := CreateArray([]Object{&String{Value: "a, b"}})
+	split := CreateArray([]Object{&String{Value: "a"}, &String{Value: "b"}})
+	if Encode(joined) == Encode(split) {
+		t.Errorf("arrays with different elements have the same encoding")
+	}
+}
+
+func TestEncodeIgnoresDependencies(t *testing.T) {
+	first := &Integer{Value: 5}
+	second := &Integer{Value: 5}
+	second.AddDependency(first)
+	if !StructurallyEqual(first, second) {
+		t.Errorf("equal integers with different dependencies have different encodings")
+	}
+	if !StructurallyEqual(first, first.Copy()) {
+		t.Errorf("copied integer has a different encoding")
+	}
+}
+
+func TestEncodeHashIsOrderIndependent(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	pairs := make(map[HashKey]HashPair)
+	for i, k := range keys {
+		key := &String{Value: k}
+		pairs[key.HashKey()] = HashPair{Key: key, Value: &Integer{Value: int64(i)}}
+	}
+	hash := CreateHash(pairs)
+	expected := Encode(hash)
+	for i := 0; i < 20; i++ {
+		if Encode(hash) != expected {
+			t.Fatalf("hash encoding is not deterministic")
+		}
+	}
+
+	reversed := make(map[HashKey]HashPair)
+	for i := len(keys) - 1; i >= 0; i-- {
+		key := &String{Value: keys[i]}
+		reversed[key.HashKey()] = HashPair{Key: key, Value: &Integer{Value: int64(i)}}
+	}
+	if Encode(CreateHash(reversed)) != expected {
+		t.Errorf("hashes with the same pairs have different encodings")
+	}
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	key := &String{Value: "k"}
+	pairs := map[HashKey]HashPair{
+		key.HashKey(): {Key: key, Value: CreateArray([]Object{&Integer{Value: 1}, &Float{Value: 2.5}, NIL})},
+	}
+	values := []Object{
+		&Integer{Value: -3},
+		&Boolean{Value: true},
+		&String{Value: "a\nb"},
+		CreateHash(pairs),
+	}
+	for _, val := range values {
+		serialized, err := Serialize(val)
+		if err != nil {
+			t.Fatalf("can't serialize %s: %s", val.Inspect(), err)
+		}
+		res, err := Deserialize(serialized)
+		if err != nil {
+			t.Fatalf("can't deserialize %s: %s", val.Inspect(), err)
+		}
+		if !StructurallyEqual(val, res) {
+			t.Errorf("round trip changed value. got=%s, want=%s", res.Inspect(), val.Inspect())
+		}
+	}
+}
+
+func TestSerializeRejectsFunctions(t *testing.T) {
+	if _, err := Serialize(CreateArray([]Object{&Builtin{}})); err == nil {
+		t.Errorf("expected an error serializing a builtin")
+	}
+}
+
+func cacheInt(c *PureFunctionCache, arg int64) {
+	args := []Object{&Integer{Value: arg}}
+	c.Set(args, []DependencyPath{{Arg: 0}}, &Integer{Value: arg * 2})
+}
+
+func cacheHas(c *PureFunctionCache, arg int64) bool {
+	_, _, ok := c.Get([]Object{&Integer{Value: arg}})
+	return ok
+}
+
+func TestPureFunctionCacheLRUEviction(t *testing.T) {
+	c := NewPureFunctionCache(NewRuntime())
+	c.SetLimit(2, LRU)
+	cacheInt(c, 1)
+	cacheInt(c, 2)
+	cacheHas(c, 1)
+	cacheInt(c, 3)
+
+	if c.Len() != 2 {
+		t.Fatalf("cache has wrong size. got=%d, want=2", c.Len())
+	}
+	if !cacheHas(c, 1) || cacheHas(c, 2) || !cacheHas(c, 3) {
+		t.Errorf("expected the least recently used result to be evicted")
+	}
+	stats := c.Stats()
+	if stats.Hits != 3 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Errorf("wrong stats. got=%+v", stats)
+	}
+}
+
+func TestPureFunctionCacheLFUEviction(t *testing.T) {
+	c := NewPureFunctionCache(NewRuntime())
+	c.SetLimit(2, LFU)
+	cacheInt(c, 1)
+	cacheHas(c, 1)
+	cacheInt(c, 2)
+	cacheHas(c, 2)
+	cacheHas(c, 2)
+	cacheHas(c, 2)
+	cacheHas(c, 1)
+	cacheInt(c, 3)
+
+	// 1 was used more recently than 2, but less often
+	if cacheHas(c, 1) || !cacheHas(c, 2) || !cacheHas(c, 3) {
+		t.Errorf("expected the least frequently used result to be evicted")
+	}
+}
+
+func TestPureFunctionCacheClear(t *testing.T) {
+	c := NewPureFunctionCache(NewRuntime())
+	cacheInt(c, 1)
+	cacheInt(c, 2)
+	c.Clear()
+	if c.Len() != 0 || cacheHas(c, 1) {
+		t.Errorf("expected an empty cache after clearing")
+	}
+	cacheInt(c, 1)
+	if !cacheHas(c, 1) {
+		t.Errorf("expected a cleared cache to be usable")
+	}
+}
+
+func TestRuntimeCacheLimit(t *testing.T) {
+	rt := NewRuntime()
+	rt.SetCacheLimit(3, LRU)
+
+	first := NewPureFunctionCache(rt)
+	second := NewPureFunctionCache(rt)
+	other := NewPureFunctionCache(NewRuntime())
+	cacheInt(first, 1)
+	cacheInt(second, 1)
+	cacheInt(other, 1)
+	cacheInt(first, 2)
+	cacheHas(first, 1)
+	cacheInt(second, 2)
+	cacheInt(other, 2)
+
+	if first.Len()+second.Len() != 3 {
+		t.Fatalf("caches hold too many results. got=%d, want=3", first.Len()+second.Len())
+	}
+	if !cacheHas(first, 1) || cacheHas(second, 1) {
+		t.Errorf("expected the least recently used result of either cache to be evicted")
+	}
+	if other.Len() != 2 {
+		t.Errorf("expected the limit to leave caches of other runtimes alone. got=%d results", other.Len())
+	}
+}
+
+func TestDependencyGraphWithoutCreatorNodes(t *testing.T) {
+	left := &Integer{Value: 1}
+	right := &Integer{Value: 2}
+	sum := &Integer{Value: 3}
+	sum.AddDependency(left)
+	sum.AddDependency(right)
+
+	graph := GetDependencyGraph(sum)
+	if len(graph.Nodes) != 3 || len(graph.Edges) != 2 {
+		t.Fatalf("wrong graph size. got=%d nodes, %d edges", len(graph.Nodes), len(graph.Edges))
+	}
+	if graph.Nodes[0].Value != "3" || graph.Nodes[0].Creator != "" || graph.Nodes[0].Span != nil {
+		t.Errorf("wrong root node. got=%+v", graph.Nodes[0])
+	}
+	for _, edge := range graph.Edges {
+		if edge.Object != 0 {
+			t.Errorf("wrong edge. got=%+v", edge)
+		}
+	}
+
+	dot := GetAllDependenciesToDotLang(sum)
+	if !strings.Contains(dot, `"INTEGER 1" -> "INTEGER 3"`) {
+		t.Errorf("missing edge in DOT output. got=%s", dot)
+	}
+}
+
+func TestSortGraphObjectsBreaksTiesOnSpan(t *testing.T) {
+	identifier := func(file string) *ast.Identifier {
+		context := token.ContextData{LineNumber: 1, PositionInLine: 4, File: file}
+		return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Context: context}, Value: "x"}
+	}
+	fromA := &Integer{Value: 1, ASTCreator: identifier("a.koko")}
+	fromB := &Integer{Value: 1, ASTCreator: identifier("b.koko")}
+	for _, objs := range [][]Object{{fromB, fromA}, {fromA, fromB}} {
+		sortGraphObjects(objs)
+		if objs[0] != fromA || objs[1] != fromB {
+			t.Fatalf("expected values from equal positions to be ordered by file")
+		}
+	}
+}
+
+func TestDiffDependencyGraphs(t *testing.T) {
+	call := func(id int, value string) GraphNode {
+		return GraphNode{ID: id, Type: INTEGER_OBJ, Value: value, Creator: "CallExpression",
+			Source: "f(x)", Span: &GraphSpan{File: "a.koko", Line: 2, Pos: 1}}
+	}
+	literal := GraphNode{ID: 2, Type: INTEGER_OBJ, Value: "1", Creator: "IntegerLiteral",
+		Source: "1", Span: &GraphSpan{File: "a.koko", Line: 1, Pos: 9}}
+	old := DependencyGraph{
+		Nodes: []GraphNode{call(0, "5"), call(1, "4"), literal},
+		Edges: []GraphEdge{{Object: 0, DependsOn: 1}, {Object: 1, DependsOn: 2}},
+	}
+	new := DependencyGraph{
+		Nodes: []GraphNode{call(0, "5"), call(1, "3")},
+		Edges: []GraphEdge{{Object: 0, DependsOn: 1}},
+	}
+
+	diff := DiffDependencyGraphs(old, new)
+	// the two calls from the same expression are aligned in order
+	if len(diff.Changed) != 1 || diff.Changed[0].Old.Value != "4" || diff.Changed[0].New.Value != "3" {
+		t.Errorf("wrong changed nodes. got=%+v", diff.Changed)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Source != "1" || len(diff.Added) != 0 {
+		t.Errorf("wrong removed nodes. got=%+v, added=%+v", diff.Removed, diff.Added)
+	}
+	if len(diff.RemovedEdges) != 1 || diff.RemovedEdges[0].DependsOn.Source != "1" || len(diff.AddedEdges) != 0 {
+		t.Errorf("wrong edges. removed=%+v, added=%+v", diff.RemovedEdges, diff.AddedEdges)
+	}
+	if !DiffDependencyGraphs(old, old).Empty() {
+		t.Errorf("expected a graph to have no differences with itself")
+	}
+}
@@ -0,0 +1,165 @@
+package object
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// persistentStore appends the results of a pure function to a file, one
+// JSON entry per line, so that they can be loaded again by later runs
+type persistentStore struct {
+	path string
+}
+
+type persistedEntry struct {
+	Paths  []persistedPath     `json:"paths"`
+	Values []*SerializedObject `json:"values"`
+	Result SerializedObject    `json:"result"`
+}
+
+type persistedPath struct {
+	Arg    int             `json:"arg"`
+	Steps  []persistedStep `json:"steps,omitempty"`
+	Length bool            `json:"length,omitempty"`
+}
+
+type persistedStep struct {
+	Index int64             `json:"index,omitempty"`
+	Key   *SerializedObject `json:"key,omitempty"`
+}
+
+// Persist backs the cache with a file in dir. The file is named after a hash
+// of fingerprint, which should identify the function: its body and the
+// values it captures. Results already in the file are loaded, and results
+// added from now on are written through to it.
+func (c *PureFunctionCache) Persist(dir string, fingerprint string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(fingerprint))
+	store := &persistentStore{path: filepath.Join(dir, hex.EncodeToString(sum[:])+".jsonl")}
+	if err := store.load(c); err != nil {
+		return err
+	}
+	c.store = store
+	return nil
+}
+
+func (s *persistentStore) load(c *PureFunctionCache) error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry persistedEntry
+		// entries which can't be read back, e.g. a line cut short by an
+		// interrupted run, are skipped
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		paths, values, result, err := entry.restore()
+		if err != nil {
+			continue
+		}
+		c.set(c.signature(paths), values, result)
+	}
+	return scanner.Err()
+}
+
+// write saves an entry. Entries holding values which can't be serialized,
+// like functions, only live in memory.
+func (s *persistentStore) write(paths []DependencyPath, values []Object, result Object) {
+	entry, err := newPersistedEntry(paths, values, result)
+	if err != nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	file.Write(append(line, '\n'))
+}
+
+func newPersistedEntry(paths []DependencyPath, values []Object, result Object) (persistedEntry, error) {
+	entry := persistedEntry{}
+	for _, p := range paths {
+		persisted := persistedPath{Arg: p.Arg, Length: p.Length}
+		for _, step := range p.Steps {
+			if step.Key == nil {
+				persisted.Steps = append(persisted.Steps, persistedStep{Index: step.Index})
+				continue
+			}
+			key, err := Serialize(step.Key)
+			if err != nil {
+				return entry, err
+			}
+			persisted.Steps = append(persisted.Steps, persistedStep{Key: &key})
+		}
+		entry.Paths = append(entry.Paths, persisted)
+	}
+	for _, val := range values {
+		if val == nil {
+			entry.Values = append(entry.Values, nil)
+			continue
+		}
+		serialized, err := Serialize(val)
+		if err != nil {
+			return entry, err
+		}
+		entry.Values = append(entry.Values, &serialized)
+	}
+	serialized, err := Serialize(result)
+	if err != nil {
+		return entry, err
+	}
+	entry.Result = serialized
+	return entry, nil
+}
+
+func (e persistedEntry) restore() ([]DependencyPath, []Object, Object, error) {
+	paths := []DependencyPath{}
+	for _, persisted := range e.Paths {
+		p := DependencyPath{Arg: persisted.Arg, Length: persisted.Length}
+		for _, step := range persisted.Steps {
+			if step.Key == nil {
+				p.Steps = append(p.Steps, PathStep{Index: step.Index})
+				continue
+			}
+			key, err := Deserialize(*step.Key)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			p.Steps = append(p.Steps, PathStep{Key: key})
+		}
+		paths = append(paths, p)
+	}
+	values := []Object{}
+	for _, serialized := range e.Values {
+		if serialized == nil {
+			values = append(values, nil)
+			continue
+		}
+		val, err := Deserialize(*serialized)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		values = append(values, val)
+	}
+	result, err := Deserialize(e.Result)
+	return paths, values, result, err
+}
@@ -0,0 +1,114 @@
+package object
+
+import (
+	"io"
+	"koko/ast"
+	"os"
+)
+
+// Runtime holds what evaluating a program needs besides its bindings: whether
+// dependencies are traced, the registry limiting the results its pure
+// functions cache, and what watches its calls and loops. Environments
+// enclosed by one share its runtime, so programs evaluated in different
+// environments don't affect each other.
+type Runtime struct {
+	// tracing turns dependency bookkeeping on and off. With tracing off,
+	// values don't record what they depend on or which expression created
+	// them, and Copy returns the value itself, which makes evaluation a lot
+	// cheaper when nobody looks at the dependencies. Shared values like TRUE
+	// and NIL are handed out as they are then, so nothing may be recorded on
+	// them.
+	tracing bool
+	// labeled tells whether any value was labeled, so that checking the
+	// labels of a value can be skipped in programs which don't use them
+	labeled bool
+	caches  cacheRegistry
+	// CacheDir is where pure functions keep their results across runs.
+	// Persistence is off while it is empty.
+	CacheDir string
+	// CallObserver, when set, is told about every call of a user defined
+	// function which didn't fail
+	CallObserver func(call *ast.CallExpression, fn Object, args []Object, res Object)
+	// Loops holds the loops being evaluated, innermost last
+	Loops []LoopFrame
+	// PureCalls counts the bodies of pure functions being evaluated, which
+	// may only call pure code
+	PureCalls int
+	// Out is where the program prints to
+	Out io.Writer
+	// Programs are the programs loaded from files, in the order they were
+	// loaded, so that the source values were created in can be shown
+	Programs []LoadedProgram
+}
+
+// LoadedProgram is a program loaded from a file along with its source
+type LoadedProgram struct {
+	File    string
+	Source  string
+	Program *ast.Program
+}
+
+// LoopFrame is a loop being evaluated: the value which decided that its body
+// runs this time, and the last value bound to each name in it
+type LoopFrame struct {
+	Control Object
+	Bound   map[string]Object
+}
+
+// NewRuntime returns a runtime which traces dependencies, prints to standard
+// output and doesn't limit the results cached by pure functions
+func NewRuntime() *Runtime {
+	return &Runtime{tracing: true, Out: os.Stdout}
+}
+
+// SetTracing turns dependency tracing on or off for every value created from
+// now on
+func (rt *Runtime) SetTracing(on bool) { rt.tracing = on }
+
+// Tracing reports whether dependency tracing is on
+func (rt *Runtime) Tracing() bool { return rt.tracing }
+
+// Copy returns a copy of obj which depends on it, or obj itself when tracing
+// is off
+func (rt *Runtime) Copy(obj Object) Object {
+	if !rt.tracing {
+		return obj
+	}
+	return obj.Copy()
+}
+
+// AddDependency makes obj depend on each of deps when tracing is on
+func (rt *Runtime) AddDependency(obj Object, deps ...Object) {
+	if !rt.tracing {
+		return
+	}
+	for _, dep := range deps {
+		obj.AddDependency(dep)
+	}
+}
+
+// SetCreatorNode records node as the expression which created obj when
+// tracing is on
+func (rt *Runtime) SetCreatorNode(obj Object, node ast.Node) {
+	if !rt.tracing {
+		return
+	}
+	obj.SetCreatorNode(node)
+}
+
+// CreateArray is CreateArray, leaving out the dependencies when tracing is
+// off
+func (rt *Runtime) CreateArray(elements []Object) *Array {
+	if !rt.tracing {
+		return &Array{Elements: elements, Length: Integer{Value: int64(len(elements))}}
+	}
+	return CreateArray(elements)
+}
+
+// CreateHash is CreateHash, leaving out the dependencies when tracing is off
+func (rt *Runtime) CreateHash(pairs map[HashKey]HashPair) *Hash {
+	if !rt.tracing {
+		return &Hash{Pairs: pairs, Length: Integer{Value: int64(len(pairs))}}
+	}
+	return CreateHash(pairs)
+}
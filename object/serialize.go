@@ -0,0 +1,113 @@
+package object
+
+import (
+	"fmt"
+	"math"
+)
+
+// SerializedObject is the JSON representation of a plain data value. Only
+// integers, floats, booleans, strings, nil, arrays and hashes of them can be
+// serialized; functions and builtins only make sense within a single run.
+type SerializedObject struct {
+	Type     ObjectType         `json:"type"`
+	Int      int64              `json:"int,omitempty"`
+	Float    float64            `json:"float,omitempty"`
+	Bool     bool               `json:"bool,omitempty"`
+	Str      string             `json:"str,omitempty"`
+	Elements []SerializedObject `json:"elements,omitempty"`
+	Pairs    []SerializedPair   `json:"pairs,omitempty"`
+}
+
+type SerializedPair struct {
+	Key   SerializedObject `json:"key"`
+	Value SerializedObject `json:"value"`
+}
+
+func Serialize(obj Object) (SerializedObject, error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return SerializedObject{Type: INTEGER_OBJ, Int: obj.Value}, nil
+	case *Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return SerializedObject{}, fmt.Errorf("can't serialize float %s", obj.Inspect())
+		}
+		return SerializedObject{Type: FLOAT_OBJ, Float: obj.Value}, nil
+	case *Boolean:
+		return SerializedObject{Type: BOOLEAN_OBJ, Bool: obj.Value}, nil
+	case *String:
+		return SerializedObject{Type: STRING_OBJ, Str: obj.Value}, nil
+	case *Nil:
+		return SerializedObject{Type: NIL_OBJ}, nil
+	case *Array:
+		out := SerializedObject{Type: ARRAY_OBJ}
+		for _, el := range obj.Elements {
+			serialized, err := Serialize(el)
+			if err != nil {
+				return SerializedObject{}, err
+			}
+			out.Elements = append(out.Elements, serialized)
+		}
+		return out, nil
+	case *Hash:
+		out := SerializedObject{Type: HASH_OBJ}
+		for _, pair := range obj.Pairs {
+			key, err := Serialize(pair.Key)
+			if err != nil {
+				return SerializedObject{}, err
+			}
+			value, err := Serialize(pair.Value)
+			if err != nil {
+				return SerializedObject{}, err
+			}
+			out.Pairs = append(out.Pairs, SerializedPair{Key: key, Value: value})
+		}
+		return out, nil
+	default:
+		return SerializedObject{}, fmt.Errorf("can't serialize %s", obj.Type())
+	}
+}
+
+func Deserialize(s SerializedObject) (Object, error) {
+	switch s.Type {
+	case INTEGER_OBJ:
+		return &Integer{Value: s.Int}, nil
+	case FLOAT_OBJ:
+		return &Float{Value: s.Float}, nil
+	case BOOLEAN_OBJ:
+		return &Boolean{Value: s.Bool}, nil
+	case STRING_OBJ:
+		return &String{Value: s.Str}, nil
+	case NIL_OBJ:
+		return &Nil{}, nil
+	case ARRAY_OBJ:
+		elements := make([]Object, 0, len(s.Elements))
+		for _, el := range s.Elements {
+			obj, err := Deserialize(el)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, obj)
+		}
+		return CreateArray(elements), nil
+	case HASH_OBJ:
+		pairs := make(map[HashKey]HashPair)
+		for _, pair := range s.Pairs {
+			key, err := Deserialize(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := Deserialize(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashKey.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return CreateHash(pairs), nil
+	default:
+		return nil, fmt.Errorf("can't deserialize %s", s.Type)
+	}
+}
@@ -0,0 +1,247 @@
+package object
+
+import (
+	"fmt"
+	"koko/ast"
+	"strings"
+)
+
+// Explain describes where a value came from: the chain of source expressions
+// leading from it to the shortest cause it originated in. Like in the DOT
+// output, copies of a value made by the same expression, offsets and builtin
+// values are left out. Parameters are mapped back to the arguments passed for
+// them.
+func Explain(result Object) string {
+	var out strings.Builder
+	var parent ast.Node
+	chain := causeChain(result)
+	for i, obj := range chain {
+		if !explainable(obj, parent) {
+			continue
+		}
+		if parent != nil {
+			out.WriteString("  from ")
+		}
+		out.WriteString(explanationLine(obj, chain[:i]))
+		out.WriteString("\n")
+		parent = obj.GetCreatorNode()
+	}
+	return strings.TrimRight(out.String(), "\n")
+}
+
+// causeChain finds the shortest path from result to a value which doesn't
+// depend on anything. Following a dependency with the same value is free, so
+// the path sticks to where the value itself came from, rather than to the
+// operands which merely selected or combined it. Operands written as literals
+// explain nothing but themselves, so they are only followed when there's
+// nothing else.
+func causeChain(result Object) []Object {
+	cost := map[Object]int{result: 0}
+	previous := make(map[Object]Object)
+	levels := map[int][]Object{0: {result}}
+	for levelCost := 0; len(levels) > 0; levelCost++ {
+		level := levels[levelCost]
+		delete(levels, levelCost)
+		for i := 0; i < len(level); i++ {
+			obj := level[i]
+			if cost[obj] != levelCost {
+				// reached more cheaply through another value since
+				continue
+			}
+			links := getObservableDepsFromObj(obj)
+			if len(links) == 0 {
+				return pathTo(obj, previous)
+			}
+			sortGraphObjects(links)
+			for _, link := range links {
+				linkCost := levelCost
+				if link.Inspect() != obj.Inspect() {
+					linkCost++
+					if literal(link) {
+						linkCost += 2
+					}
+				}
+				if known, ok := cost[link]; ok && known <= linkCost {
+					continue
+				}
+				cost[link] = linkCost
+				previous[link] = obj
+				if linkCost == levelCost {
+					level = append(level, link)
+				} else {
+					levels[linkCost] = append(levels[linkCost], link)
+				}
+			}
+		}
+	}
+	return []Object{result}
+}
+
+// literal reports whether obj is a value which doesn't depend on anything,
+// written as a literal
+func literal(obj Object) bool {
+	if len(getObservableDepsFromObj(obj)) > 0 {
+		return false
+	}
+	switch obj.GetCreatorNode().(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	}
+	return false
+}
+
+func pathTo(obj Object, previous map[Object]Object) []Object {
+	path := []Object{obj}
+	for prev, ok := previous[obj]; ok; prev, ok = previous[prev] {
+		path = append([]Object{prev}, path...)
+	}
+	return path
+}
+
+// explainable reports whether obj gets its own line in an explanation, or is
+// just passed through to the values it depends on
+func explainable(obj Object, parent ast.Node) bool {
+	creator := obj.GetCreatorNode()
+	if creator == nil {
+		return false
+	}
+	if _, ok := creator.(*ast.BuiltinValue); ok {
+		return false
+	}
+	if _, ok := obj.(*Offset); ok {
+		return false
+	}
+	return parent == nil || creator.String() != parent.String()
+}
+
+// explanationLine describes obj, given the values before it in the chain,
+// which it caused
+func explanationLine(obj Object, effects []Object) string {
+	creator := sourceNode(obj.GetCreatorNode())
+	line := fmt.Sprintf("%s `%s`", previewValue(obj), creator.String())
+	reason := ""
+	switch creator := creator.(type) {
+	case *ast.Identifier:
+		line = fmt.Sprintf("%s, the value of `%s`", previewValue(obj), creator.Value)
+	case *ast.LengthNode:
+		line = fmt.Sprintf("%s, the length of `%s`", previewValue(obj), creator.Child.String())
+	case *ast.IndexExpression:
+		reason = indexedArgument(obj, creator, effects)
+	}
+	if reason == "" {
+		reason = passedArgument(creator, effects)
+	}
+	return line + location(creator) + reason
+}
+
+// sourceNode is the expression a statement got its value from
+func sourceNode(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		if node.Expression != nil {
+			return node.Expression
+		}
+	case *ast.BlockStatement:
+		if len(node.Statements) > 0 {
+			return sourceNode(node.Statements[len(node.Statements)-1])
+		}
+	case *ast.Program:
+		if len(node.Statements) > 0 {
+			return sourceNode(node.Statements[len(node.Statements)-1])
+		}
+	}
+	return node
+}
+
+func location(node ast.Node) string {
+	span := node.Span()
+	if span.Empty() {
+		return ""
+	}
+	if span.File != "" {
+		return fmt.Sprintf(" at %s line %d, pos %d", span.File, span.BeginLine, span.BeginPos)
+	}
+	return fmt.Sprintf(" at line %d, pos %d", span.BeginLine, span.BeginPos)
+}
+
+// passedArgument says which parameter node was passed for, when the value
+// it caused was read from a parameter of a call it was an argument of
+func passedArgument(node ast.Node, effects []Object) string {
+	if len(effects) == 0 {
+		return ""
+	}
+	param, ok := effects[len(effects)-1].GetCreatorNode().(*ast.Identifier)
+	if !ok {
+		return ""
+	}
+	index, ok := argumentIndex(node, effects)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(", because `%s` was argument %d for `%s`", node.String(), index, param.Value)
+}
+
+// argumentIndex finds node among the arguments of the nearest call which
+// created one of effects
+func argumentIndex(node ast.Node, effects []Object) (int, bool) {
+	for i := len(effects) - 1; i >= 0; i-- {
+		call, ok := effects[i].GetCreatorNode().(*ast.CallExpression)
+		if !ok {
+			continue
+		}
+		for index, arg := range call.Arguments {
+			if arg == node {
+				return index, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// indexedArgument says which expression an index into a parameter indexed,
+// e.g. that `x[2]` was `a[2]` because `a` was passed for `x`
+func indexedArgument(obj Object, node *ast.IndexExpression, effects []Object) string {
+	param, ok := node.Left.(*ast.Identifier)
+	if !ok {
+		return ""
+	}
+	left := argumentFor(obj, param.Value)
+	if left == nil {
+		return ""
+	}
+	index, ok := argumentIndex(left, effects)
+	if !ok {
+		return ""
+	}
+	indexed := &ast.IndexExpression{Token: node.Token, Left: left, Index: node.Index}
+	return fmt.Sprintf(", which was `%s` because `%s` was argument %d%s",
+		indexed.String(), left.String(), index, location(left))
+}
+
+// argumentFor finds the expression passed for the parameter name among the
+// offsets obj depends on. The offset of a parameter's value depends on the
+// offset of the argument, which was created by the expression passed.
+func argumentFor(obj Object, name string) ast.Expression {
+	seen := make(map[Object]bool)
+	queue := []Object{obj}
+	for len(queue) > 0 {
+		ident, ok := queue[0].GetCreatorNode().(*ast.Identifier)
+		param := ok && ident.Value == name
+		links := []Object{}
+		for link := range queue[0].GetDependencyLinks() {
+			if offset, ok := link.(*Offset); ok && !seen[offset] {
+				seen[offset] = true
+				links = append(links, offset)
+			}
+		}
+		queue = queue[1:]
+		sortGraphObjects(links)
+		for _, link := range links {
+			if arg, ok := link.GetCreatorNode().(ast.Expression); ok && param {
+				return arg
+			}
+			queue = append(queue, link)
+		}
+	}
+	return nil
+}
@@ -6,13 +6,17 @@ import (
 	"koko/lexer"
 	"koko/token"
 	"strconv"
+	"unicode/utf8"
 )
 
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = or +=
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
-	LESSGREATER // > or <
+	LESSGREATER // > or <, >= or <=
 	MODULO
 	SUM     // +
 	PRODUCT // *
@@ -22,17 +26,25 @@ const (
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PERCENT:  MODULO,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PERCENT:         MODULO,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 type (
@@ -62,6 +74,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.STRING_START, p.parseInterpolatedString)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
@@ -84,6 +97,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -130,11 +151,25 @@ func (p *Parser) peekError(t token.TokenType) {
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
 	if t == token.ASSIGN {
-		msg = "Missing let before `=` operator"
+		msg = "Missing name before `=` operator"
+	}
+	if t == token.ILLEGAL {
+		msg = p.illegalTokenError(p.curToken)
 	}
 	p.errors = append(p.errors, msg)
 }
 
+// illegalTokenError describes an ILLEGAL token: the lexer gives characters it
+// doesn't know as they are, and describes the problem with literals which
+// are malformed
+func (p *Parser) illegalTokenError(tok token.Token) string {
+	problem := tok.Literal
+	if utf8.RuneCountInString(problem) == 1 {
+		problem = fmt.Sprintf("unexpected character `%s`", problem)
+	}
+	return fmt.Sprintf("%s, pos %d: %s", tok.Context, tok.Context.PositionInLine, problem)
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
@@ -154,10 +189,22 @@ func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
+	case token.CELL:
+		return p.parseCellStatement()
+	case token.CONST:
+		return p.parseConstStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
 	case token.IMPORT:
 		return p.parseImportStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -187,6 +234,54 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseConstStatement() ast.Statement {
+	stmt := &ast.ConstStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseCellStatement() *ast.CellStatement {
+	stmt := &ast.CellStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -276,6 +371,32 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	}
 }
 
+// parseInterpolatedString parses a string with expressions in it, which the
+// lexer gives as the text up to each `${`, the expressions, and the text
+// after each `}`
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+	for {
+		str.Parts = append(str.Parts, p.parseStringLiteral())
+		if p.curTokenIs(token.STRING_END) {
+			return str
+		}
+		if p.peekTokenIs(token.STRING_MIDDLE) || p.peekTokenIs(token.STRING_END) {
+			msg := fmt.Sprintf("%s: missing expression in `${}`", p.peekToken.Context)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		p.nextToken()
+		str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+		if !p.peekTokenIs(token.STRING_MIDDLE) && !p.peekTokenIs(token.STRING_END) {
+			msg := fmt.Sprintf("%s: expected `}` to close `${`, got %s instead", p.peekToken.Context, p.peekToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseCommentLiteral() ast.Expression {
 	return &ast.CommentLiteral{
 		Token: p.curToken,
@@ -356,6 +477,38 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return exp
 }
 
+// parseAssignExpression parses assignments right to left, so `a = b = 1`
+// assigns 1 to both
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	if !assignable(target) {
+		msg := fmt.Sprintf("%s: can't assign to %s", p.curToken.Context, target.String())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+	return expression
+}
+
+// assignable reports whether an expression can be assigned to: a name, or
+// an element of something a name is bound to, e.g. `grid[y][x]`
+func assignable(target ast.Expression) bool {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		return true
+	case *ast.IndexExpression:
+		return assignable(target.Left)
+	}
+	return false
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 
@@ -376,19 +529,131 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 	expression.Consequence = p.parseBlockStatement()
 
-	if p.peekTokenIs(token.ELSE) {
+	if p.peekTokenIs(token.ELSIF) {
 		p.nextToken()
-
-		if !p.expectPeek(token.LBRACE) {
+		expression.Alternative = p.parseElseIf()
+		if expression.Alternative == nil {
 			return nil
 		}
+	} else if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
 
-		expression.Alternative = p.parseBlockStatement()
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			expression.Alternative = p.parseElseIf()
+			if expression.Alternative == nil {
+				return nil
+			}
+		} else {
+			if !p.expectPeek(token.LBRACE) {
+				return nil
+			}
+
+			expression.Alternative = p.parseBlockStatement()
+		}
 	}
 
 	return expression
 }
 
+// parseElseIf parses the rest of an if chain, starting at its `elsif` or the
+// `if` of its `else if`, into an else block holding a nested if expression
+func (p *Parser) parseElseIf() *ast.BlockStatement {
+	tok := p.curToken
+	nested := p.parseIfExpression()
+	if nested == nil {
+		return nil
+	}
+	return &ast.BlockStatement{
+		Token:      tok,
+		Statements: []ast.Statement{&ast.ExpressionStatement{Token: tok, Expression: nested}},
+	}
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseBreakStatement() ast.Statement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() ast.Statement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -511,8 +776,30 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		exp.Index = p.parseExpression(LOWEST)
+	}
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp.Token, left, exp.Index)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseSliceExpression parses the rest of s[start:end] from the colon on
+func (p *Parser) parseSliceExpression(tok token.Token, left ast.Expression, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
@@ -70,6 +70,130 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestCellStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"cell x = 5;", "x", 5},
+		{"cell total = y", "total", "y"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input, "test_parser.koko")
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.CellStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.CellStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name.Value != tt.expectedIdentifier {
+			t.Errorf("stmt.Name.Value not '%s'. got=%s", tt.expectedIdentifier, stmt.Name.Value)
+		}
+		if !testLiteralExpression(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"const x = 5;", "x", 5},
+		{"const limit = y", "limit", "y"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input, "test_parser.koko")
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ConstStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ConstStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name.Value != tt.expectedIdentifier {
+			t.Errorf("stmt.Name.Value not '%s'. got=%s", tt.expectedIdentifier, stmt.Name.Value)
+		}
+		if !testLiteralExpression(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+		expected string
+	}{
+		{"x = 5", "=", "(x = 5)"},
+		{"x += 1 + 2", "+=", "(x += (1 + 2))"},
+		{"x -= y * 2", "-=", "(x -= (y * 2))"},
+		{"x *= 3", "*=", "(x *= 3)"},
+		{"a = b = c", "=", "(a = (b = c))"},
+		{"a = b || c", "=", "(a = (b || c))"},
+		{"a[0] = 1", "=", "((a[0]) = 1)"},
+		{"grid[y][x] += 1", "+=", "(((grid[y])[x]) += 1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input, "test_parser.koko")
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if exp.Operator != tt.operator {
+			t.Errorf("exp.Operator is not '%s'. got=%s", tt.operator, exp.Operator)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	invalid := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2", "test_parser.koko line 1: can't assign to 1"},
+		{"f(x) += 1", "test_parser.koko line 1: can't assign to f(x)"},
+		{"f(x)[0] = 1", "test_parser.koko line 1: can't assign to (f(x)[0])"},
+	}
+	for _, tt := range invalid {
+		p := New(lexer.New(tt.input, "test_parser.koko"))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. got=%v, want=%q", tt.input, p.Errors(), tt.expected)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -288,6 +412,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"!-a",
 			"(!(-a))",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a < b && !c == d",
+			"((a < b) && ((!c) == d))",
+		},
+		{
+			"a + b <= c * d == true",
+			"(((a + b) <= (c * d)) == true)",
+		},
+		{
+			"a >= b || c",
+			"((a >= b) || c)",
+		},
 		{
 			"a + b + c",
 			"((a + b) + c)",
@@ -388,6 +532,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a[1:b + 1] + a[:2] + a[c:] + a[:]",
+			"((((a[1:(b + 1)]) + (a[:2])) + (a[c:])) + (a[:]))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -548,6 +696,252 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestElsifExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"if (a) { x } elsif (b) { y } else { z }",
+			"if a { { x } } else { { if b { { y } } else { { z } } } }",
+		},
+		{
+			"if (a) { x } else if (b) { y } elsif (c) { z }",
+			"if a { { x } } else { { if b { { y } } else { { if c { { z } }  } } } }",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input, "test_parser.koko")
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+				1, len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	input := `if (a) { x }
+elsif (b) { y }`
+	program := New(lexer.New(input, "test_parser.koko")).ParseProgram()
+	exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("alternative is not 1 statements. got=%d\n", len(exp.Alternative.Statements))
+	}
+	nested, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative is not ast.IfExpression. got=%T", exp.Alternative.Statements[0])
+	}
+	if !testIdentifier(t, nested.Condition, "b") {
+		return
+	}
+	if span := nested.Span(); span.BeginLine != 2 || span.BeginPos != 1 {
+		t.Errorf("nested if expression has wrong span. got line %d, pos %d", span.BeginLine, span.BeginPos)
+	}
+	if nested.Alternative != nil {
+		t.Errorf("nested.Alternative was not nil. got=%+v", nested.Alternative)
+	}
+}
+
+func TestElsifExpressionErrors(t *testing.T) {
+	tests := []string{
+		"if (a) { x } elsif { y }",
+		"if (a) { x } elsif (b) y",
+		"if (a) { x } else if b { y }",
+	}
+	for _, input := range tests {
+		p := New(lexer.New(input, "test_parser.koko"))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	input := `"sum ${a + b} of ${"${c}"}"`
+
+	l := lexer.New(input, "test_parser.koko")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+	if len(str.Parts) != 5 {
+		t.Fatalf("str.Parts does not contain 5 parts. got=%d", len(str.Parts))
+	}
+	for i, text := range []string{"sum ", " of ", ""} {
+		literal, ok := str.Parts[2*i].(*ast.StringLiteral)
+		if !ok || literal.Value != text {
+			t.Errorf("str.Parts[%d] is not %q. got=%s", 2*i, text, str.Parts[2*i])
+		}
+	}
+	if !testInfixExpression(t, str.Parts[1], "a", "+", "b") {
+		return
+	}
+	if _, ok := str.Parts[3].(*ast.InterpolatedString); !ok {
+		t.Errorf("str.Parts[3] not *ast.InterpolatedString. got=%T", str.Parts[3])
+	}
+	if expected := `"sum ${(a + b)} of ${"${c}"}"`; program.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestInterpolatedStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = "a ${} b"`, "test_parser.koko line 1: missing expression in `${}`"},
+		{`let s = "a ${x y} b"`, "test_parser.koko line 1: expected `}` to close `${`, got IDENT instead"},
+		{`let s = "a ${x`, "test_parser.koko line 1: expected `}` to close `${`, got EOF instead"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input, "test_parser.koko"))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. got=%v, want=%q", tt.input, p.Errors(), tt.expected)
+		}
+	}
+}
+
+func TestSliceExpressionErrors(t *testing.T) {
+	tests := []string{
+		"a[1:2",
+		"a[1:2:3]",
+		"a[1:] = 2",
+	}
+	for _, input := range tests {
+		p := New(lexer.New(input, "test_parser.koko"))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestIllegalTokenErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = "open`, "test_parser.koko line 1, pos 8: unterminated string"},
+		{"let a = 1\nlet s = `open", "test_parser.koko line 2, pos 9: unterminated raw string"},
+		{`let s = "a\qb"`, "test_parser.koko line 1, pos 8: invalid escape sequence \\q"},
+		{"let a = 1 & 2", "test_parser.koko line 1, pos 10: unexpected character `&`"},
+		{`let é = "é" # 2`, "test_parser.koko line 1, pos 12: unexpected character `#`"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input, "test_parser.koko"))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. got=%v, want=%q", tt.input, p.Errors(), tt.expected)
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { let x = x + 1; continue; }`
+
+	l := lexer.New(input, "test_parser.koko")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[0].(*ast.LetStatement); !ok {
+		t.Errorf("Statements[0] is not ast.LetStatement. got=%T", stmt.Body.Statements[0])
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("Statements[1] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[1])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (x in xs) { if (x) { break; } }`
+
+	l := lexer.New(input, "test_parser.koko")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if stmt.Variable.Value != "x" {
+		t.Errorf("stmt.Variable.Value not 'x'. got=%s", stmt.Variable.Value)
+	}
+	if !testIdentifier(t, stmt.Iterable, "xs") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+	ifStmt, ok := stmt.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", stmt.Body.Statements[0])
+	}
+	consequence := ifStmt.Expression.(*ast.IfExpression).Consequence
+	if _, ok := consequence.Statements[0].(*ast.BreakStatement); !ok {
+		t.Errorf("consequence is not ast.BreakStatement. got=%T", consequence.Statements[0])
+	}
+}
+
+func TestForStatementErrors(t *testing.T) {
+	tests := []string{
+		"for x in xs { x }",
+		"for (x xs) { x }",
+		"for (1 in xs) { x }",
+		"while x { x }",
+	}
+	for _, input := range tests {
+		p := New(lexer.New(input, "test_parser.koko"))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -8,11 +8,18 @@ import (
 	"koko/lexer"
 	"koko/object"
 	"koko/parser"
+	"strings"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
+// WHY_COMMAND explains where the value of the expression following it came
+// from, like the why builtin
+const WHY_COMMAND = ":why "
+
+// Start reads lines from in and evaluates them in one environment, with opts
+// in effect, writing their values to out
+func Start(in io.Reader, out io.Writer, opts evaluator.EvalOptions) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
 
@@ -24,6 +31,10 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
+		why := strings.HasPrefix(line, WHY_COMMAND)
+		if why {
+			line = strings.TrimPrefix(line, WHY_COMMAND)
+		}
 		l := lexer.New(line, "konsole")
 		p := parser.New(l)
 
@@ -33,7 +44,12 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		evaluated := evaluator.EvalWithOptions(program, env, opts)
+		if why && evaluated != nil && evaluated.Type() != object.ERROR_OBJ {
+			io.WriteString(out, object.Explain(evaluated))
+			io.WriteString(out, "\n")
+			continue
+		}
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
@@ -37,6 +37,12 @@ const (
 	FLOAT  = "FLOAT" // 1.232
 	STRING = "STRING"
 
+	// Interpolated strings, e.g. "a ${x} b ${y} c" is STRING_START "a ", x,
+	// STRING_MIDDLE " b ", y, STRING_END " c"
+	STRING_START  = "STRING_START"
+	STRING_MIDDLE = "STRING_MIDDLE"
+	STRING_END    = "STRING_END"
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -46,11 +52,22 @@ const (
 	ASTERISK = "*"
 	SLASH    = "/"
 
+	// Compound assignments
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+
 	// Comparisons
 	EQ     = "=="
 	NOT_EQ = "!="
 	LT     = "<"
 	GT     = ">"
+	LT_EQ  = "<="
+	GT_EQ  = ">="
+
+	// Logical operators
+	AND = "&&"
+	OR  = "||"
 
 	// Delimeters
 	COLON     = ":"
@@ -70,6 +87,8 @@ const (
 	FUNCTION      = "FUNCTION"
 	PURE_FUNCTION = "PURE_FUNCTION"
 	LET           = "LET"
+	CELL          = "CELL"
+	CONST         = "CONST"
 	TRUE          = "TRUE"
 	FALSE         = "FALSE"
 	IF            = "IF"
@@ -77,20 +96,32 @@ const (
 	ELSIF         = "ELSIF"
 	RETURN        = "RETURN"
 	IMPORT        = "IMPORT"
+	WHILE         = "WHILE"
+	FOR           = "FOR"
+	IN            = "IN"
+	BREAK         = "BREAK"
+	CONTINUE      = "CONTINUE"
 )
 
 // Jem: Would be cool to make this default lookup the token type in all caps??
 var keywords = map[string]TokenType{
-	"else":   ELSE,
-	"elsif":  ELSIF,
-	"false":  FALSE,
-	"fn":     FUNCTION,
-	"if":     IF,
-	"import": IMPORT,
-	"let":    LET,
-	"pfn":    PURE_FUNCTION,
-	"return": RETURN,
-	"true":   TRUE,
+	"break":    BREAK,
+	"cell":     CELL,
+	"const":    CONST,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"elsif":    ELSIF,
+	"false":    FALSE,
+	"fn":       FUNCTION,
+	"for":      FOR,
+	"if":       IF,
+	"import":   IMPORT,
+	"in":       IN,
+	"let":      LET,
+	"pfn":      PURE_FUNCTION,
+	"return":   RETURN,
+	"true":     TRUE,
+	"while":    WHILE,
 }
 
 func LookupIdent(ident string) TokenType {